@@ -0,0 +1,38 @@
+terraform {
+  required_providers {
+    sealedsecret = {
+      version = ">=1.2.0"
+      source  = "akselleirv/sealedsecret"
+    }
+  }
+}
+
+provider "sealedsecret" {
+  kubernetes {
+    host                   = var.k8s_host
+    client_certificate     = base64decode(var.k8s_client_certificate)
+    client_key             = base64decode(var.k8s_client_key)
+    cluster_ca_certificate = base64decode(var.k8s_cluster_ca_certificate)
+  }
+}
+
+data "sealedsecret_doctor" "this" {}
+
+output "checks" {
+  value = data.sealedsecret_doctor.this.checks
+}
+
+variable "k8s_client_certificate" {
+  type = string
+}
+
+variable "k8s_client_key" {
+  type = string
+}
+
+variable "k8s_cluster_ca_certificate" {
+  type = string
+}
+variable "k8s_host" {
+  type = string
+}
@@ -0,0 +1,96 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	// aksServerAppID is the well-known application ID of the AKS AAD server.
+	aksServerAppID = "6dae42f8-4368-4678-94ff-3960e28e3630"
+	imdsTokenURL   = "http://169.254.169.254/metadata/identity/oauth2/token"
+)
+
+// AKSConfig obtains Azure AD tokens for AKS clusters with AAD integration, instead of running az or kubelogin.
+// A service principal is used when ClientSecret is set, otherwise the managed identity of the host.
+type AKSConfig struct {
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+	// IgnoreProxyEnvironment disables the proxy environment variables for the requests to Azure AD.
+	IgnoreProxyEnvironment bool
+}
+
+// TokenSource returns a token source which refreshes the access token when it expires.
+func (c *AKSConfig) TokenSource() (oauth2.TokenSource, error) {
+	if c.ClientSecret != "" {
+		if c.TenantID == "" || c.ClientID == "" {
+			return nil, fmt.Errorf("tenant id and client id are required to authenticate with a client secret")
+		}
+		cfg := clientcredentials.Config{
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			TokenURL:     fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", c.TenantID),
+			Scopes:       []string{aksServerAppID + "/.default"},
+		}
+		// the token source outlives the provider configuration, so it must not be bound to its context
+		return cfg.TokenSource(context.WithValue(context.Background(), oauth2.HTTPClient, httpClient(c.IgnoreProxyEnvironment))), nil
+	}
+	return oauth2.ReuseTokenSource(nil, &managedIdentityTokenSource{tokenURL: imdsTokenURL, clientID: c.ClientID}), nil
+}
+
+// managedIdentityTokenSource requests tokens from the Azure instance metadata service.
+type managedIdentityTokenSource struct {
+	tokenURL string
+	// clientID selects a user-assigned identity, empty uses the system-assigned identity.
+	clientID string
+}
+
+func (s *managedIdentityTokenSource) Token() (*oauth2.Token, error) {
+	q := url.Values{}
+	q.Set("api-version", "2018-02-01")
+	q.Set("resource", aksServerAppID)
+	if s.clientID != "" {
+		q.Set("client_id", s.clientID)
+	}
+	req, err := http.NewRequest(http.MethodGet, s.tokenURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+
+	// the instance metadata service is link-local, so it is never reached through a proxy
+	resp, err := httpClient(true).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to the Azure instance metadata service failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the Azure instance metadata service returned %s", resp.Status)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresOn   string `json:"expires_on"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("unable to decode the managed identity token: %w", err)
+	}
+	expiresOn, err := strconv.ParseInt(body.ExpiresOn, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the managed identity token expiry: %w", err)
+	}
+	return &oauth2.Token{
+		AccessToken: body.AccessToken,
+		TokenType:   "Bearer",
+		Expiry:      time.Unix(expiresOn, 0),
+	}, nil
+}
@@ -0,0 +1,31 @@
+package k8s
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManagedIdentityTokenSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "true", r.Header.Get("Metadata"))
+		assert.Equal(t, aksServerAppID, r.URL.Query().Get("resource"))
+		assert.Equal(t, "client_aaa", r.URL.Query().Get("client_id"))
+		w.Write([]byte(`{"access_token":"token_aaa","expires_on":"1700000000"}`))
+	}))
+	defer srv.Close()
+
+	token, err := (&managedIdentityTokenSource{tokenURL: srv.URL, clientID: "client_aaa"}).Token()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "token_aaa", token.AccessToken)
+	assert.Equal(t, int64(1700000000), token.Expiry.Unix())
+}
+
+func TestAKSTokenSourceRequiresTenantForClientSecret(t *testing.T) {
+	_, err := (&AKSConfig{ClientID: "client_aaa", ClientSecret: "secret_aaa"}).TokenSource()
+
+	assert.Error(t, err)
+}
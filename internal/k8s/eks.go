@@ -0,0 +1,99 @@
+package k8s
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"golang.org/x/oauth2"
+)
+
+const (
+	eksTokenPrefix = "k8s-aws-v1."
+	// eksClusterIDHeader binds the presigned request to the cluster, as done by aws eks get-token.
+	eksClusterIDHeader = "x-k8s-aws-id"
+	// eksTokenLifetime is shorter than the 15 minutes the presigned URL is accepted by EKS,
+	// so a token is refreshed before it expires.
+	eksTokenLifetime = 14 * time.Minute
+)
+
+// EKSConfig generates Amazon EKS tokens from the AWS SDK credentials chain, instead of running aws eks get-token.
+type EKSConfig struct {
+	ClusterName string
+	Region      string
+	Profile     string
+	// RoleARN is assumed before generating the token, if set.
+	RoleARN string
+	// IgnoreProxyEnvironment disables the proxy environment variables for the requests to AWS, e.g. to assume RoleARN.
+	IgnoreProxyEnvironment bool
+}
+
+// TokenSource returns a token source generating a new token when the previous one is about to expire.
+func (c *EKSConfig) TokenSource() (oauth2.TokenSource, error) {
+	var opts []func(*config.LoadOptions) error
+	if c.Region != "" {
+		opts = append(opts, config.WithRegion(c.Region))
+	}
+	if c.Profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(c.Profile))
+	}
+	if c.IgnoreProxyEnvironment {
+		opts = append(opts, config.WithHTTPClient(awshttp.NewBuildableClient().WithTransportOptions(func(t *http.Transport) {
+			t.Proxy = nil
+		})))
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load AWS config: %w", err)
+	}
+
+	if c.RoleARN != "" {
+		cfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), c.RoleARN))
+	}
+	return oauth2.ReuseTokenSource(nil, &eksTokenSource{sts: sts.NewPresignClient(sts.NewFromConfig(cfg)), clusterName: c.ClusterName}), nil
+}
+
+type eksTokenSource struct {
+	sts         *sts.PresignClient
+	clusterName string
+}
+
+// Token presigns a GetCallerIdentity request, which EKS uses to verify the identity of the caller.
+func (s *eksTokenSource) Token() (*oauth2.Token, error) {
+	req, err := s.sts.PresignGetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{}, func(o *sts.PresignOptions) {
+		o.ClientOptions = append(o.ClientOptions, func(o *sts.Options) {
+			o.APIOptions = append(o.APIOptions, smithyhttp.SetHeaderValue(eksClusterIDHeader, s.clusterName), eksPresignExpiry)
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate EKS token: %w", err)
+	}
+	return &oauth2.Token{
+		AccessToken: eksTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(req.URL)),
+		TokenType:   "Bearer",
+		Expiry:      time.Now().Add(eksTokenLifetime),
+	}, nil
+}
+
+// eksPresignExpiry limits the presigned URL to 60 seconds, as done by aws eks get-token.
+func eksPresignExpiry(stack *middleware.Stack) error {
+	return stack.Build.Add(middleware.BuildMiddlewareFunc("EKSPresignExpiry", func(
+		ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler,
+	) (middleware.BuildOutput, middleware.Metadata, error) {
+		if req, ok := in.Request.(*smithyhttp.Request); ok {
+			q := req.URL.Query()
+			q.Set("X-Amz-Expires", "60")
+			req.URL.RawQuery = q.Encode()
+		}
+		return next.HandleBuild(ctx, in)
+	}), middleware.After)
+}
@@ -0,0 +1,35 @@
+package k8s
+
+import (
+	"encoding/base64"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEKSTokenSource(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_ACCESS_KEY_ID", "access_key_aaa")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret_key_aaa")
+
+	ts, err := (&EKSConfig{ClusterName: "cluster_aaa", Region: "eu-west-1", IgnoreProxyEnvironment: true}).TokenSource()
+	assert.NoError(t, err)
+	token, err := ts.Token()
+	assert.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(token.AccessToken, eksTokenPrefix))
+	presigned, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token.AccessToken, eksTokenPrefix))
+	assert.NoError(t, err)
+	u, err := url.Parse(string(presigned))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "sts.eu-west-1.amazonaws.com", u.Host)
+	assert.Equal(t, "GetCallerIdentity", u.Query().Get("Action"))
+	assert.Contains(t, u.Query().Get("X-Amz-SignedHeaders"), eksClusterIDHeader)
+	assert.Equal(t, "60", u.Query().Get("X-Amz-Expires"))
+}
@@ -0,0 +1,36 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// gkeDefaultScopes are the scopes requested by gke-gcloud-auth-plugin.
+var gkeDefaultScopes = []string{
+	"https://www.googleapis.com/auth/cloud-platform",
+	"https://www.googleapis.com/auth/userinfo.email",
+}
+
+// GKEConfig obtains Google access tokens from the application default credentials, instead of running gcloud.
+type GKEConfig struct {
+	Scopes []string
+	// IgnoreProxyEnvironment disables the proxy environment variables for the requests to Google.
+	IgnoreProxyEnvironment bool
+}
+
+// TokenSource returns a token source which refreshes the access token when it expires.
+func (c *GKEConfig) TokenSource() (oauth2.TokenSource, error) {
+	scopes := c.Scopes
+	if len(scopes) == 0 {
+		scopes = gkeDefaultScopes
+	}
+	// the token source outlives the provider configuration, so it must not be bound to its context
+	ts, err := google.DefaultTokenSource(context.WithValue(context.Background(), oauth2.HTTPClient, httpClient(c.IgnoreProxyEnvironment)), scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find Google application default credentials: %w", err)
+	}
+	return ts, nil
+}
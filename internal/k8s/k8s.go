@@ -5,11 +5,16 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"sort"
 	"time"
 
+	"golang.org/x/oauth2"
 	"k8s.io/apimachinery/pkg/util/wait"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
 var frontoff = wait.Backoff{
@@ -22,12 +27,65 @@ var frontoff = wait.Backoff{
 
 type Client struct {
 	RestClient *corev1.CoreV1Client
+	// ControllerScheme and ControllerPort select the service port used by Get, see Config.
+	ControllerScheme, ControllerPort string
 }
 
 type Config struct {
+	// ConfigPaths are kubeconfig files merged in the same way as the KUBECONFIG environment variable.
+	// The fields below take precedence over the values from the kubeconfig.
+	ConfigPaths []string
+	// ConfigContext overrides the current context of the kubeconfig.
+	ConfigContext ConfigContext
+	// InCluster uses the service account mounted into the pod, instead of a kubeconfig.
+	InCluster bool
+
 	Host                                 string
 	ClusterCACert, ClientCert, ClientKey []byte
-	Transport                            http.RoundTripper
+	// TLSServerName overrides the server name used for SNI and to verify the API server certificate.
+	TLSServerName string
+	// Insecure skips the verification of the API server certificate, only meant for development clusters.
+	Insecure bool
+	// Token is a bearer token used instead of, or in addition to, the client certificate.
+	Token string
+	// Username and Password are used for basic authentication.
+	Username, Password string
+	// Exec runs a credential plugin to obtain short-lived credentials.
+	Exec *ExecConfig
+	// OIDC authenticates with OpenID Connect ID tokens which are refreshed when they expire.
+	OIDC *OIDCConfig
+	// TokenSource provides bearer tokens which are refreshed when they expire, e.g. from EKSConfig.
+	TokenSource oauth2.TokenSource
+	Transport   http.RoundTripper
+	// ProxyURL is used for all requests to the API server, taking precedence over the proxy environment variables.
+	ProxyURL string
+	// IgnoreProxyEnvironment disables the use of HTTPS_PROXY, HTTP_PROXY and NO_PROXY.
+	IgnoreProxyEnvironment bool
+	// QPS and Burst configure the client-side rate limiter, zero keeps the client-go defaults.
+	QPS   float32
+	Burst int
+	// MaxIdleConnsPerHost and IdleConnTimeout tune the pooled transport, zero keeps the client-go defaults.
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+
+	// ControllerScheme is the scheme used to proxy requests to the controller, http if empty.
+	ControllerScheme string
+	// ControllerPort is the name or number of the controller's service port.
+	// If empty, the API server picks the port, which only works for services with a single port.
+	ControllerPort string
+}
+
+// ConfigContext selects the context, user and cluster from a kubeconfig, empty values keep the current context.
+type ConfigContext struct {
+	Name, AuthInfo, Cluster string
+}
+
+// ExecConfig configures a client-go credential plugin such as aws eks get-token or kubelogin.
+type ExecConfig struct {
+	APIVersion string
+	Command    string
+	Args       []string
+	Env        map[string]string
 }
 
 type Clienter interface {
@@ -35,33 +93,198 @@ type Clienter interface {
 }
 
 func NewClient(cfg *Config) (*Client, error) {
-	restCfg := &rest.Config{
-		Timeout: 10 * time.Second,
+	restCfg, err := restConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := corev1.NewForConfig(restCfg)
+	if err != nil {
+		return nil, err
+	}
+	scheme := cfg.ControllerScheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	return &Client{RestClient: c, ControllerScheme: scheme, ControllerPort: cfg.ControllerPort}, nil
+}
+
+func restConfig(cfg *Config) (*rest.Config, error) {
+	restCfg := &rest.Config{}
+	switch {
+	case cfg.InCluster:
+		var err error
+		restCfg, err = rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("unable to load in-cluster config: %w", err)
+		}
+	case len(cfg.ConfigPaths) > 0:
+		var err error
+		restCfg, err = loadKubeconfig(cfg.ConfigPaths, cfg.ConfigContext)
+		if err != nil {
+			return nil, err
+		}
+	}
+	restCfg.Timeout = 10 * time.Second
+
+	if cfg.Host != "" {
+		restCfg.Host = cfg.Host
+	}
+	if len(cfg.ClusterCACert) > 0 {
+		restCfg.CAData = cfg.ClusterCACert
+	}
+	if len(cfg.ClientCert) > 0 {
+		restCfg.CertData = cfg.ClientCert
+	}
+	if len(cfg.ClientKey) > 0 {
+		restCfg.KeyData = cfg.ClientKey
+	}
+	if cfg.TLSServerName != "" {
+		restCfg.ServerName = cfg.TLSServerName
+	}
+	if cfg.Insecure {
+		// client-go refuses a CA together with the insecure flag, so drop the one from the kubeconfig
+		restCfg.Insecure = true
+		restCfg.CAData = nil
+		restCfg.CAFile = ""
+	}
+	if cfg.Token != "" {
+		restCfg.BearerToken = cfg.Token
+		restCfg.BearerTokenFile = ""
+	}
+	if cfg.Username != "" {
+		restCfg.Username = cfg.Username
+		restCfg.Password = cfg.Password
+	}
+	if cfg.Exec != nil {
+		restCfg.ExecProvider = execProvider(cfg.Exec)
+	}
+	if cfg.OIDC != nil {
+		ts, err := cfg.OIDC.tokenSource(cfg.IgnoreProxyEnvironment)
+		if err != nil {
+			return nil, err
+		}
+		// replaces an auth provider from the kubeconfig, like the other credentials
+		restCfg.AuthProvider = nil
+		restCfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &oauth2.Transport{Source: ts, Base: rt}
+		})
 	}
-	restCfg.Host = cfg.Host
-	restCfg.CAData = cfg.ClusterCACert
-	restCfg.CertData = cfg.ClientCert
-	restCfg.KeyData = cfg.ClientKey
 	if cfg.Transport != nil {
 		restCfg.Transport = cfg.Transport
 	}
+	switch {
+	case cfg.ProxyURL != "":
+		u, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+		restCfg.Proxy = http.ProxyURL(u)
+	case cfg.IgnoreProxyEnvironment:
+		restCfg.Proxy = noProxy
+	}
+	if cfg.QPS > 0 {
+		restCfg.QPS = cfg.QPS
+	}
+	if cfg.Burst > 0 {
+		restCfg.Burst = cfg.Burst
+	}
+	if cfg.MaxIdleConnsPerHost > 0 || cfg.IdleConnTimeout > 0 {
+		restCfg.Wrap(tuneTransport(cfg.MaxIdleConnsPerHost, cfg.IdleConnTimeout))
+	}
+	if cfg.TokenSource != nil {
+		restCfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &oauth2.Transport{Source: cfg.TokenSource, Base: rt}
+		})
+	}
+	return restCfg, nil
+}
 
-	c, err := corev1.NewForConfig(restCfg)
+func execProvider(cfg *ExecConfig) *clientcmdapi.ExecConfig {
+	env := make([]clientcmdapi.ExecEnvVar, 0, len(cfg.Env))
+	for name, value := range cfg.Env {
+		env = append(env, clientcmdapi.ExecEnvVar{Name: name, Value: value})
+	}
+	sort.Slice(env, func(i, j int) bool { return env[i].Name < env[j].Name })
+
+	return &clientcmdapi.ExecConfig{
+		APIVersion: cfg.APIVersion,
+		Command:    cfg.Command,
+		Args:       cfg.Args,
+		Env:        env,
+		// Terraform does not provide an interactive terminal to the provider
+		InteractiveMode: clientcmdapi.NeverExecInteractiveMode,
+	}
+}
+
+// loadKubeconfig merges the kubeconfig files and returns the config of the current context, or the one of ctx.
+func loadKubeconfig(paths []string, ctx ConfigContext) (*rest.Config, error) {
+	rules := &clientcmd.ClientConfigLoadingRules{Precedence: paths}
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: ctx.Name,
+		Context: clientcmdapi.Context{
+			AuthInfo: ctx.AuthInfo,
+			Cluster:  ctx.Cluster,
+		},
+	}
+	restCfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("unable to load kubeconfig: %w", err)
+	}
+	return restCfg, nil
+}
+
+// tuneTransport adjusts the connection pool of the transport built by client-go.
+// Custom transports are left untouched.
+func tuneTransport(maxIdleConnsPerHost int, idleConnTimeout time.Duration) func(http.RoundTripper) http.RoundTripper {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		t, ok := rt.(*http.Transport)
+		if !ok {
+			return rt
+		}
+		if maxIdleConnsPerHost > 0 {
+			t.MaxIdleConnsPerHost = maxIdleConnsPerHost
+		}
+		if idleConnTimeout > 0 {
+			t.IdleConnTimeout = idleConnTimeout
+		}
+		return t
+	}
+}
+
+func noProxy(*http.Request) (*url.URL, error) {
+	return nil, nil
+}
+
+// httpClient returns a client for requests outside of the API server, e.g. to token endpoints. The proxy
+// environment variables are used unless ignoreProxyEnvironment is set.
+func httpClient(ignoreProxyEnvironment bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if ignoreProxyEnvironment {
+		transport.Proxy = nil
+	}
+	return &http.Client{Transport: transport, Timeout: 10 * time.Second}
+}
+
+// Ping checks that the API server is reachable and that the credentials are accepted.
+func (c *Client) Ping(ctx context.Context) error {
+	if err := c.RestClient.RESTClient().Get().AbsPath("/version").Do(ctx).Error(); err != nil {
+		return fmt.Errorf("request to k8s cluster failed: %w", err)
 	}
-	return &Client{RestClient: c}, nil
+	return nil
 }
 
 func (c *Client) Get(ctx context.Context, controllerName, controllerNamespace, path string) ([]byte, error) {
 	resp, err := c.RestClient.
 		Services(controllerNamespace).
-		ProxyGet("http", controllerName, "8080", path, nil).
+		ProxyGet(c.ControllerScheme, controllerName, c.ControllerPort, path, nil).
 		Stream(ctx)
 
 	if err != nil {
 		return nil, fmt.Errorf("request to k8s cluster failed: %w", err)
 	}
+	// the body must be closed for the connection to be reused
+	defer resp.Close()
 	b, err := io.ReadAll(resp)
 	if err != nil {
 		return nil, fmt.Errorf("unable to read response from k8 cluster: %w", err)
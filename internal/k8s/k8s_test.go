@@ -2,11 +2,19 @@ package k8s
 
 import (
 	"context"
+	"encoding/base64"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
 	"io/ioutil"
+	"k8s.io/client-go/rest"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 type roundTripFunc func(req *http.Request) (*http.Response, error)
@@ -65,3 +73,373 @@ func TestGet(t *testing.T) {
 		})
 	}
 }
+
+func TestTuneTransport(t *testing.T) {
+	tr := &http.Transport{MaxIdleConnsPerHost: 1, IdleConnTimeout: time.Second}
+	rt := tuneTransport(50, 0)(tr)
+
+	assert.Same(t, tr, rt)
+	assert.Equal(t, 50, tr.MaxIdleConnsPerHost)
+	assert.Equal(t, time.Second, tr.IdleConnTimeout)
+
+	custom := roundTripFunc(func(req *http.Request) (*http.Response, error) { return nil, nil })
+	assert.NotNil(t, tuneTransport(50, time.Minute)(custom))
+}
+
+func TestPing(t *testing.T) {
+	tests := []struct {
+		Name        string
+		StatusCode  int
+		ExpectedErr bool
+	}{
+		{Name: "reachable", StatusCode: http.StatusOK},
+		{Name: "unauthorized", StatusCode: http.StatusUnauthorized, ExpectedErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			var path string
+			c, err := NewClient(&Config{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				path = req.URL.Path
+				return &http.Response{
+					StatusCode: tc.StatusCode,
+					Body:       ioutil.NopCloser(strings.NewReader("{}")),
+				}, nil
+			})})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = c.Ping(context.Background())
+			assert.Equal(t, "/version", path)
+			assert.Equal(t, tc.ExpectedErr, err != nil)
+		})
+	}
+}
+
+const kubeconfig = `
+apiVersion: v1
+kind: Config
+clusters:
+- name: cluster_aaa
+  cluster:
+    server: https://kubeconfig-host:6443
+- name: cluster_bbb
+  cluster:
+    server: https://other-host:6443
+users:
+- name: user_aaa
+  user:
+    token: token_aaa
+- name: user_bbb
+  user:
+    token: token_ccc
+contexts:
+- name: context_aaa
+  context:
+    cluster: cluster_aaa
+    user: user_aaa
+- name: context_bbb
+  context:
+    cluster: cluster_bbb
+    user: user_aaa
+current-context: context_aaa
+`
+
+func TestRestConfigFromKubeconfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(kubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name          string
+		Config        Config
+		ExpectedHost  string
+		ExpectedToken string
+	}{
+		{
+			Name:          "values are read from the kubeconfig",
+			Config:        Config{ConfigPaths: []string{path}},
+			ExpectedHost:  "https://kubeconfig-host:6443",
+			ExpectedToken: "token_aaa",
+		},
+		{
+			Name:          "explicit values take precedence",
+			Config:        Config{ConfigPaths: []string{path}, Host: "https://explicit-host"},
+			ExpectedHost:  "https://explicit-host",
+			ExpectedToken: "token_aaa",
+		},
+		{
+			Name:          "explicit token takes precedence",
+			Config:        Config{ConfigPaths: []string{path}, Token: "token_bbb"},
+			ExpectedHost:  "https://kubeconfig-host:6443",
+			ExpectedToken: "token_bbb",
+		},
+		{
+			Name:          "context is selected",
+			Config:        Config{ConfigPaths: []string{path}, ConfigContext: ConfigContext{Name: "context_bbb"}},
+			ExpectedHost:  "https://other-host:6443",
+			ExpectedToken: "token_aaa",
+		},
+		{
+			Name:          "user of the context is overridden",
+			Config:        Config{ConfigPaths: []string{path}, ConfigContext: ConfigContext{AuthInfo: "user_bbb"}},
+			ExpectedHost:  "https://kubeconfig-host:6443",
+			ExpectedToken: "token_ccc",
+		},
+		{
+			Name:          "token without kubeconfig",
+			Config:        Config{Host: "https://explicit-host", Token: "token_bbb"},
+			ExpectedHost:  "https://explicit-host",
+			ExpectedToken: "token_bbb",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			restCfg, err := restConfig(&tc.Config)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.ExpectedHost, restCfg.Host)
+			assert.Equal(t, tc.ExpectedToken, restCfg.BearerToken)
+		})
+	}
+}
+
+func TestRestConfigWithExec(t *testing.T) {
+	restCfg, err := restConfig(&Config{
+		Host: "https://explicit-host",
+		Exec: &ExecConfig{
+			APIVersion: "client.authentication.k8s.io/v1beta1",
+			Command:    "aws",
+			Args:       []string{"eks", "get-token", "--cluster-name", "cluster_aaa"},
+			Env:        map[string]string{"B": "b", "A": "a"},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "aws", restCfg.ExecProvider.Command)
+	assert.Equal(t, []string{"eks", "get-token", "--cluster-name", "cluster_aaa"}, restCfg.ExecProvider.Args)
+	assert.Equal(t, "A", restCfg.ExecProvider.Env[0].Name)
+	assert.Equal(t, "B", restCfg.ExecProvider.Env[1].Name)
+}
+
+func TestRestConfigInClusterOutsideCluster(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+
+	_, err := restConfig(&Config{InCluster: true})
+
+	assert.ErrorIs(t, err, rest.ErrNotInCluster)
+}
+
+func TestRestConfigInsecure(t *testing.T) {
+	restCfg, err := restConfig(&Config{Host: "https://explicit-host", Insecure: true})
+	assert.NoError(t, err)
+	assert.True(t, restCfg.Insecure)
+	assert.Empty(t, restCfg.CAData)
+
+	_, err = NewClient(&Config{Host: "https://explicit-host", Insecure: true})
+	assert.NoError(t, err)
+}
+
+func TestRestConfigProxy(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://explicit-host/version", nil)
+	tests := []struct {
+		Name          string
+		Config        Config
+		ExpectedProxy string
+	}{
+		{
+			Name:          "explicit proxy",
+			Config:        Config{ProxyURL: "http://proxy:3128"},
+			ExpectedProxy: "http://proxy:3128",
+		},
+		{
+			Name:          "explicit proxy takes precedence over ignoring the environment",
+			Config:        Config{ProxyURL: "http://proxy:3128", IgnoreProxyEnvironment: true},
+			ExpectedProxy: "http://proxy:3128",
+		},
+		{
+			Name:          "environment is ignored",
+			Config:        Config{IgnoreProxyEnvironment: true},
+			ExpectedProxy: "",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			tc.Config.Host = "https://explicit-host"
+			restCfg, err := restConfig(&tc.Config)
+			assert.NoError(t, err)
+
+			u, err := restCfg.Proxy(req)
+			assert.NoError(t, err)
+			if tc.ExpectedProxy == "" {
+				assert.Nil(t, u)
+				return
+			}
+			assert.Equal(t, tc.ExpectedProxy, u.String())
+		})
+	}
+}
+
+func TestRestConfigBasicAuth(t *testing.T) {
+	restCfg, err := restConfig(&Config{Host: "https://explicit-host", Username: "user_aaa", Password: "password_aaa"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "user_aaa", restCfg.Username)
+	assert.Equal(t, "password_aaa", restCfg.Password)
+}
+
+func TestRestConfigTLSServerName(t *testing.T) {
+	restCfg, err := restConfig(&Config{Host: "https://load-balancer:6443", TLSServerName: "kubernetes.default.svc"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "kubernetes.default.svc", restCfg.ServerName)
+}
+
+func TestRestConfigRateLimit(t *testing.T) {
+	restCfg, err := restConfig(&Config{Host: "https://explicit-host", QPS: 20, Burst: 40})
+
+	assert.NoError(t, err)
+	assert.Equal(t, float32(20), restCfg.QPS)
+	assert.Equal(t, 40, restCfg.Burst)
+}
+
+func TestTokenSourceSetsAuthorizationHeader(t *testing.T) {
+	var auth string
+	c, err := NewClient(&Config{
+		TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token_aaa"}),
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			auth = req.Header.Get("Authorization")
+			return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("{}"))}, nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, c.Ping(context.Background()))
+	assert.Equal(t, "Bearer token_aaa", auth)
+}
+
+func TestOIDCRefreshesIDToken(t *testing.T) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, time.Now().Add(time.Hour).Unix())))
+	idToken := "eyJhbGciOiJub25lIn0." + payload + ".sig"
+
+	var refreshToken string
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			fmt.Fprintf(w, `{"token_endpoint":"http://%s/token"}`, r.Host)
+		case "/token":
+			refreshToken = r.FormValue("refresh_token")
+			fmt.Fprintf(w, `{"access_token":"access","token_type":"Bearer","expires_in":3600,"id_token":%q}`, idToken)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer issuer.Close()
+
+	var auth string
+	c, err := NewClient(&Config{
+		Host: "https://127.0.0.1:6443",
+		OIDC: &OIDCConfig{
+			IssuerURL:    issuer.URL,
+			ClientID:     "client_aaa",
+			RefreshToken: "refresh_aaa",
+		},
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			auth = req.Header.Get("Authorization")
+			return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("{}"))}, nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, c.Ping(context.Background()))
+	assert.Equal(t, "refresh_aaa", refreshToken)
+	assert.Equal(t, "Bearer "+idToken, auth)
+}
+
+func TestOIDCRotatesRefreshToken(t *testing.T) {
+	idToken := func(exp time.Time) string {
+		return "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, exp.Unix()))) + ".sig"
+	}
+
+	var refreshTokens []string
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			fmt.Fprintf(w, `{"token_endpoint":"http://%s/token"}`, r.Host)
+		case "/token":
+			refreshTokens = append(refreshTokens, r.FormValue("refresh_token"))
+			// expires right away, so the next request refreshes again
+			fmt.Fprintf(w, `{"access_token":"access","token_type":"Bearer","refresh_token":"rotated_%d","id_token":%q}`, len(refreshTokens), idToken(time.Now()))
+		}
+	}))
+	defer issuer.Close()
+
+	valid := idToken(time.Now().Add(time.Hour))
+	ts, err := (&OIDCConfig{
+		IssuerURL:    issuer.URL,
+		ClientID:     "client_aaa",
+		RefreshToken: "refresh_aaa",
+		IDToken:      valid,
+	}).tokenSource(true)
+	assert.NoError(t, err)
+
+	token, err := ts.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, valid, token.AccessToken)
+	assert.Empty(t, refreshTokens, "a valid ID token is used without refreshing")
+
+	ts, err = (&OIDCConfig{IssuerURL: issuer.URL, ClientID: "client_aaa", RefreshToken: "refresh_aaa"}).tokenSource(true)
+	assert.NoError(t, err)
+	_, err = ts.Token()
+	assert.NoError(t, err)
+	_, err = ts.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"refresh_aaa", "rotated_1"}, refreshTokens)
+}
+
+func TestSelectorClientGet(t *testing.T) {
+	var services string
+	c, err := NewClient(&Config{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body := "cert_aaa"
+		switch req.URL.Path {
+		case "/api/v1/namespaces/ns_aaa/services":
+			assert.Equal(t, "app.kubernetes.io/name=sealed-secrets", req.URL.Query().Get("labelSelector"))
+			body = services
+		case "/api/v1/namespaces/ns_aaa/services/http:renamed-controller:/proxy/v1/cert.pem":
+		default:
+			t.Errorf("unexpected request to %s", req.URL.Path)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})})
+	assert.NoError(t, err)
+	sc := &SelectorClient{Client: c, Selector: "app.kubernetes.io/name=sealed-secrets"}
+
+	services = `{"kind":"ServiceList","apiVersion":"v1","items":[{"metadata":{"name":"renamed-controller"}}]}`
+	b, err := sc.Get(context.Background(), "ignored", "ns_aaa", "/v1/cert.pem")
+	assert.NoError(t, err)
+	assert.Equal(t, "cert_aaa", string(b))
+
+	services = `{"kind":"ServiceList","apiVersion":"v1","items":[]}`
+	_, err = sc.Get(context.Background(), "ignored", "ns_aaa", "/v1/cert.pem")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no service matching")
+
+	services = `{"kind":"ServiceList","apiVersion":"v1","items":[{"metadata":{"name":"b"}},{"metadata":{"name":"a"}}]}`
+	_, err = sc.Get(context.Background(), "ignored", "ns_aaa", "/v1/cert.pem")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "multiple services matching \"app.kubernetes.io/name=sealed-secrets\" found in namespace ns_aaa: a, b")
+}
@@ -34,11 +34,20 @@ type SecretManifest struct {
 	Data      map[string]interface{}
 }
 
+// DockerConfigJSONType is the secret type where the data is expected to already be base64 encoded.
+const DockerConfigJSONType = "kubernetes.io/dockerconfigjson"
+
+// ServiceAccountTokenType is the secret type populated with a token of the service account named in ServiceAccountNameAnnotation.
+const ServiceAccountTokenType = "kubernetes.io/service-account-token"
+
+// ServiceAccountNameAnnotation is required on secrets of ServiceAccountTokenType.
+const ServiceAccountNameAnnotation = "kubernetes.io/service-account.name"
+
 var ErrEmptyData = errors.New("secret manifest Data and StringData cannot be empty")
 
 func CreateSecret(sm *SecretManifest) (v1.Secret, error) {
 	// if it is a .docker/config.json file then the data should already be base64 encoded
-	if sm.Type != "kubernetes.io/dockerconfigjson" {
+	if sm.Type != DockerConfigJSONType {
 		sm.Data = b64EncodeMapValue(sm.Data)
 	}
 	secretManifestYAML := new(bytes.Buffer)
@@ -59,6 +68,21 @@ func CreateSecret(sm *SecretManifest) (v1.Secret, error) {
 	return secret, nil
 }
 
+// ParseSecret decodes a YAML or JSON v1 Secret manifest.
+func ParseSecret(manifest []byte) (v1.Secret, error) {
+	var secret v1.Secret
+	if err := runtime.DecodeInto(scheme.Codecs.UniversalDecoder(), manifest, &secret); err != nil {
+		return v1.Secret{}, fmt.Errorf("unable to decode the secret manifest: %w", err)
+	}
+	if secret.Kind != "" && secret.Kind != "Secret" {
+		return v1.Secret{}, fmt.Errorf("expected a manifest of kind Secret, got %s", secret.Kind)
+	}
+	if secret.Name == "" {
+		return v1.Secret{}, errors.New("the secret manifest must have a name")
+	}
+	return secret, nil
+}
+
 func b64EncodeMapValue(m map[string]interface{}) map[string]interface{} {
 	result := map[string]interface{}{}
 	for key, value := range m {
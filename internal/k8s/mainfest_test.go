@@ -37,3 +37,33 @@ func TestCreateSecret(t *testing.T) {
 	}
 
 }
+
+func TestParseSecret(t *testing.T) {
+	secret, err := ParseSecret([]byte(`
+apiVersion: v1
+kind: Secret
+metadata:
+  name: name_aaa
+  namespace: ns_aaa
+  labels:
+    app: app_aaa
+type: kubernetes.io/tls
+stringData:
+  tls.key: key_aaa
+data:
+  tls.crt: Y2VydF9hYWE=
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, "name_aaa", secret.Name)
+	assert.Equal(t, "ns_aaa", secret.Namespace)
+	assert.Equal(t, "app_aaa", secret.Labels["app"])
+	assert.Equal(t, "kubernetes.io/tls", string(secret.Type))
+	assert.Equal(t, "key_aaa", secret.StringData["tls.key"])
+	assert.Equal(t, "cert_aaa", string(secret.Data["tls.crt"]))
+
+	_, err = ParseSecret([]byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: name_aaa\n"))
+	assert.Error(t, err)
+
+	_, err = ParseSecret([]byte("apiVersion: v1\nkind: Secret\nmetadata:\n  namespace: ns_aaa\n"))
+	assert.Error(t, err)
+}
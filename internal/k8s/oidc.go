@@ -0,0 +1,144 @@
+package k8s
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	// registers the oidc auth provider used by kubeconfig users with an oidc auth-provider
+	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
+)
+
+// OIDCConfig authenticates with an OpenID Connect ID token. The ID token is refreshed with the
+// refresh token before every request where it is missing or expired, so long applies keep working.
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RefreshToken string
+	// IDToken is used until it expires, a new one is requested right away if empty.
+	IDToken string
+	// IssuerCACert is used to verify the certificate of the issuer.
+	IssuerCACert []byte
+}
+
+// tokenSource returns a token source providing the ID token as bearer token. The requests to the issuer
+// use the proxy environment variables unless ignoreProxyEnvironment is set.
+func (c *OIDCConfig) tokenSource(ignoreProxyEnvironment bool) (oauth2.TokenSource, error) {
+	client := httpClient(ignoreProxyEnvironment)
+	if len(c.IssuerCACert) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(c.IssuerCACert) {
+			return nil, errors.New("invalid issuer CA certificate")
+		}
+		client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	var token *oauth2.Token
+	if c.IDToken != "" {
+		if expiry, err := idTokenExpiry(c.IDToken); err == nil {
+			token = &oauth2.Token{AccessToken: c.IDToken, TokenType: "Bearer", Expiry: expiry}
+		}
+	}
+	return oauth2.ReuseTokenSource(token, &oidcTokenSource{config: c, client: client, refreshToken: c.RefreshToken}), nil
+}
+
+// oidcTokenSource refreshes the ID token, as done by the oidc auth provider of client-go.
+type oidcTokenSource struct {
+	config *OIDCConfig
+	client *http.Client
+	// tokenURL is discovered from the issuer on the first refresh.
+	tokenURL string
+	// refreshToken is replaced when the issuer rotates it.
+	refreshToken string
+}
+
+func (s *oidcTokenSource) Token() (*oauth2.Token, error) {
+	if s.refreshToken == "" {
+		return nil, errors.New("the OIDC ID token is missing or expired and there is no refresh token")
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, s.client)
+	if s.tokenURL == "" {
+		tokenURL, err := s.discoverTokenURL(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.tokenURL = tokenURL
+	}
+
+	cfg := oauth2.Config{
+		ClientID:     s.config.ClientID,
+		ClientSecret: s.config.ClientSecret,
+		Endpoint:     oauth2.Endpoint{TokenURL: s.tokenURL},
+	}
+	token, err := cfg.TokenSource(ctx, &oauth2.Token{RefreshToken: s.refreshToken}).Token()
+	if err != nil {
+		return nil, fmt.Errorf("unable to refresh the OIDC ID token: %w", err)
+	}
+	idToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("the OIDC token response does not contain an id_token")
+	}
+	expiry, err := idTokenExpiry(idToken)
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken != "" {
+		s.refreshToken = token.RefreshToken
+	}
+	return &oauth2.Token{AccessToken: idToken, TokenType: "Bearer", Expiry: expiry}, nil
+}
+
+func (s *oidcTokenSource) discoverTokenURL(ctx context.Context) (string, error) {
+	wellKnown := strings.TrimSuffix(s.config.IssuerURL, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid OIDC issuer url: %w", err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request to the OIDC issuer failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("request to the OIDC issuer failed: %s %s", wellKnown, resp.Status)
+	}
+
+	var metadata struct {
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return "", fmt.Errorf("unable to decode the OIDC issuer metadata: %w", err)
+	}
+	if metadata.TokenEndpoint == "" {
+		return "", errors.New("the OIDC issuer metadata does not contain a token_endpoint")
+	}
+	return metadata.TokenEndpoint, nil
+}
+
+// idTokenExpiry returns the exp claim of the ID token. The signature is verified by the API server.
+func idTokenExpiry(idToken string) (time.Time, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("the OIDC ID token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to decode the OIDC ID token: %w", err)
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("unable to decode the OIDC ID token: %w", err)
+	}
+	return time.Unix(claims.Exp, 0), nil
+}
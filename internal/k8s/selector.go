@@ -0,0 +1,46 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SelectorClient discovers the controller service by a label selector, e.g. app.kubernetes.io/name=sealed-secrets,
+// so the configuration survives renames of the Helm release.
+type SelectorClient struct {
+	Client   *Client
+	Selector string
+}
+
+// Get ignores the controller name and proxies the request to the single service matching the selector.
+func (c *SelectorClient) Get(ctx context.Context, _, controllerNamespace, path string) ([]byte, error) {
+	name, err := c.Client.FindService(ctx, controllerNamespace, c.Selector)
+	if err != nil {
+		return nil, err
+	}
+	return c.Client.Get(ctx, name, controllerNamespace, path)
+}
+
+// FindService returns the name of the only service in namespace matching the label selector.
+func (c *Client) FindService(ctx context.Context, namespace, selector string) (string, error) {
+	services, err := c.RestClient.Services(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return "", fmt.Errorf("unable to list services matching %q in namespace %s: %w", selector, namespace, err)
+	}
+	switch len(services.Items) {
+	case 0:
+		return "", fmt.Errorf("no service matching %q found in namespace %s", selector, namespace)
+	case 1:
+		return services.Items[0].Name, nil
+	}
+	names := make([]string, 0, len(services.Items))
+	for _, s := range services.Items {
+		names = append(names, s.Name)
+	}
+	sort.Strings(names)
+	return "", fmt.Errorf("multiple services matching %q found in namespace %s: %s", selector, namespace, strings.Join(names, ", "))
+}
@@ -0,0 +1,46 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// URLClient fetches from a controller exposed outside of the cluster, e.g. through an Ingress or a LoadBalancer,
+// instead of going through the API server service proxy.
+type URLClient struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewURLClient returns a client for the controller at baseURL. The proxy environment variables are
+// used unless ignoreProxyEnvironment is set.
+func NewURLClient(baseURL string, ignoreProxyEnvironment bool) *URLClient {
+	return &URLClient{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: httpClient(ignoreProxyEnvironment),
+	}
+}
+
+// Get ignores the controller name and namespace, since the URL already points to the controller.
+func (c *URLClient) Get(ctx context.Context, _, _, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid controller url: %w", err)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to controller failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request to controller failed: %s %s", req.URL, resp.Status)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response from controller: %w", err)
+	}
+	return b, nil
+}
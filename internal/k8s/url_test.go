@@ -0,0 +1,36 @@
+package k8s
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURLClientGet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/cert.pem" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("cert_aaa"))
+	}))
+	defer srv.Close()
+
+	c := NewURLClient(srv.URL+"/", true)
+
+	b, err := c.Get(context.Background(), "ignored", "ignored", "/v1/cert.pem")
+	assert.NoError(t, err)
+	assert.Equal(t, "cert_aaa", string(b))
+
+	_, err = c.Get(context.Background(), "ignored", "ignored", "/v1/unknown")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "404 Not Found")
+}
+
+func TestHTTPClientIgnoresProxyEnvironment(t *testing.T) {
+	assert.NotNil(t, httpClient(false).Transport.(*http.Transport).Proxy)
+	assert.Nil(t, httpClient(true).Transport.(*http.Transport).Proxy)
+}
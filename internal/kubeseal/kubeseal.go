@@ -1,55 +1,264 @@
 package kubeseal
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/akselleirv/sealedsecret/internal/k8s"
 	ssv1alpha1 "github.com/bitnami-labs/sealed-secrets/pkg/apis/sealed-secrets/v1alpha1"
+	"github.com/bitnami-labs/sealed-secrets/pkg/crypto"
+	"io"
 	v1 "k8s.io/api/core/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	runtimeserializer "k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/util/cert"
+	goruntime "runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
+// CertFingerprintAnnotation records the fingerprint of the certificate used for sealing.
+const CertFingerprintAnnotation = "sealedsecret-provider/cert-fingerprint"
+
+// sealWorkers is the number of keys encrypted concurrently.
+var sealWorkers = goruntime.NumCPU()
+
 type PKResolverFunc = func(ctx context.Context) (*rsa.PublicKey, error)
 
+type CertResolverFunc = func(ctx context.Context) (*x509.Certificate, error)
+
+type CertsResolverFunc = func(ctx context.Context) ([]*x509.Certificate, error)
+
 func FetchPK(c k8s.Clienter, controllerName, controllerNamespace string) PKResolverFunc {
-	doReq := func(ctx context.Context) (*rsa.PublicKey, error) {
+	return PKResolver(FetchCert(c, controllerName, controllerNamespace))
+}
+
+// PKResolver extracts the RSA public key from the certificate returned by certResolver.
+func PKResolver(certResolver CertResolverFunc) PKResolverFunc {
+	return func(ctx context.Context) (*rsa.PublicKey, error) {
+		c, err := certResolver(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return PublicKey(c)
+	}
+}
+
+// ErrNotPEM is returned when the controller's response does not contain a PEM encoded certificate,
+// e.g. an HTML page of another service.
+var ErrNotPEM = errors.New("the response is not a PEM encoded certificate")
+
+// ErrNotRSA is returned when the certificate does not contain an RSA public key.
+var ErrNotRSA = errors.New("the certificate does not contain an RSA public key")
+
+// PublicKey returns the RSA public key of the certificate.
+func PublicKey(c *x509.Certificate) (*rsa.PublicKey, error) {
+	pk, ok := c.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w, got %T", ErrNotRSA, c.PublicKey)
+	}
+	return pk, nil
+}
+
+// ParseCerts parses the PEM encoded certificates, the error includes the start of data if it is not PEM.
+func ParseCerts(data []byte) ([]*x509.Certificate, error) {
+	if !bytes.Contains(data, []byte("-----BEGIN CERTIFICATE-----")) {
+		return nil, fmt.Errorf("%w, got %q", ErrNotPEM, abbreviate(string(bytes.TrimSpace(data)), 64))
+	}
+	certs, err := cert.ParseCertsPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotPEM, err)
+	}
+	return certs, nil
+}
+
+func abbreviate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// FetchCert fetches the certificates from the controller once and returns the newest active one, see NewestCert.
+func FetchCert(c k8s.Clienter, controllerName, controllerNamespace string) CertResolverFunc {
+	return NewestCert(FetchCerts(c, controllerName, controllerNamespace))
+}
+
+// FetchCerts fetches all certificates from the controller once and caches them for the lifetime of the provider.
+// The controller returns more than one certificate while keys are rotated.
+func FetchCerts(c k8s.Clienter, controllerName, controllerNamespace string) CertsResolverFunc {
+	doReq := func(ctx context.Context) ([]*x509.Certificate, error) {
 		resp, err := c.Get(ctx, controllerName, controllerNamespace, "/v1/cert.pem")
 		if err != nil {
 			return nil, err
 		}
-		certs, err := cert.ParseCertsPEM(resp)
+		return ParseCerts(resp)
+	}
+
+	var certificates []*x509.Certificate
+	var err error
+	// mu is held during the request, so concurrent resources wait for a single fetch instead of each making one.
+	var mu sync.Mutex
+
+	return func(ctx context.Context) ([]*x509.Certificate, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil && k8sErrors.IsNotFound(err) || k8sErrors.IsServiceUnavailable(err) {
+			certificates, err = doReq(ctx)
+		}
+		if certificates == nil && err == nil {
+			certificates, err = doReq(ctx)
+		}
+		return certificates, err
+	}
+}
+
+// StaticCert returns a resolver for a locally supplied PEM encoded certificate, to seal without access to the controller.
+// If certPEM contains more than one certificate, the newest active one is used.
+func StaticCert(certPEM []byte) (CertResolverFunc, error) {
+	certs, err := StaticCerts(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	return NewestCert(certs), nil
+}
+
+// StaticCerts returns a resolver for all certificates in certPEM.
+func StaticCerts(certPEM []byte) (CertsResolverFunc, error) {
+	certs, err := ParseCerts(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the controller certificate: %w", err)
+	}
+	return func(context.Context) ([]*x509.Certificate, error) {
+		return certs, nil
+	}, nil
+}
+
+// NewestCert returns the certificate with the latest NotBefore among the currently valid ones.
+// If none is valid, the one with the latest NotBefore is returned.
+func NewestCert(certsResolver CertsResolverFunc) CertResolverFunc {
+	return func(ctx context.Context) (*x509.Certificate, error) {
+		certs, err := certsResolver(ctx)
 		if err != nil {
 			return nil, err
 		}
+		return newestCert(certs, time.Now())
+	}
+}
 
-		pk, ok := certs[0].PublicKey.(*rsa.PublicKey)
-		if !ok {
-			err = fmt.Errorf("expected public key, got: %v", certs[0].PublicKey)
+func newestCert(certs []*x509.Certificate, now time.Time) (*x509.Certificate, error) {
+	var newest, newestActive *x509.Certificate
+	for _, c := range certs {
+		if newest == nil || c.NotBefore.After(newest.NotBefore) {
+			newest = c
 		}
-		return pk, nil
+		active := !now.Before(c.NotBefore) && !now.After(c.NotAfter)
+		if active && (newestActive == nil || c.NotBefore.After(newestActive.NotBefore)) {
+			newestActive = c
+		}
+	}
+	if newestActive != nil {
+		return newestActive, nil
 	}
+	if newest == nil {
+		return nil, errors.New("no certificate found")
+	}
+	return newest, nil
+}
 
-	var publicKey *rsa.PublicKey
-	var err error
+// ErrCertFingerprintMismatch is returned when the fetched certificate does not match the pinned fingerprint.
+var ErrCertFingerprintMismatch = errors.New("the sealing certificate does not match the pinned fingerprint, refusing to seal")
 
-	return func(ctx context.Context) (*rsa.PublicKey, error) {
-		if err != nil && k8sErrors.IsNotFound(err) || k8sErrors.IsServiceUnavailable(err) {
-			publicKey, err = doReq(ctx)
+// PinCert wraps certResolver and rejects any certificate whose SHA-256 fingerprint differs from fingerprint.
+// The fingerprint is matched case-insensitively and may be colon separated.
+func PinCert(certResolver CertResolverFunc, fingerprint string) CertResolverFunc {
+	pinned := strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+	return func(ctx context.Context) (*x509.Certificate, error) {
+		c, err := certResolver(ctx)
+		if err != nil {
+			return nil, err
 		}
-		if publicKey == nil && err == nil {
-			publicKey, err = doReq(ctx)
+		if actual := CertFingerprint(c); actual != pinned {
+			return nil, fmt.Errorf("%w: expected %s, got %s", ErrCertFingerprintMismatch, pinned, actual)
 		}
-		return publicKey, err
+		return c, nil
+	}
+}
+
+// RecommendedKeySize is the recommended minimum RSA key size in bits.
+const RecommendedKeySize = 4096
+
+// ErrKeyTooSmall is returned when the sealing key is smaller than the required minimum.
+var ErrKeyTooSmall = errors.New("the sealing key is too small, refusing to seal")
+
+// CheckKeySize returns ErrKeyTooSmall if pk is smaller than minBits.
+func CheckKeySize(pk *rsa.PublicKey, minBits int) error {
+	if bits := pk.N.BitLen(); bits < minBits {
+		return fmt.Errorf("%w: the key has %d bits, the minimum is %d", ErrKeyTooSmall, bits, minBits)
 	}
+	return nil
 }
 
-func SealSecret(secret v1.Secret, pk *rsa.PublicKey) ([]byte, error) {
+// CertFingerprint returns the hex encoded SHA-256 fingerprint of the DER encoded certificate.
+func CertFingerprint(c *x509.Certificate) string {
+	return fmt.Sprintf("%x", sha256.Sum256(c.Raw))
+}
+
+// SetScope annotates the secret with the sealing scope, which SealSecret uses for the encryption label.
+// The scope is one of strict, namespace-wide or cluster-wide, as accepted by kubeseal --scope.
+func SetScope(secret *v1.Secret, scope string) error {
+	var s ssv1alpha1.SealingScope
+	if err := s.Set(scope); err != nil {
+		return fmt.Errorf("invalid scope %q: %w", scope, err)
+	}
+	if s > ssv1alpha1.DefaultScope {
+		secret.Annotations = ssv1alpha1.UpdateScopeAnnotations(secret.Annotations, s)
+	}
+	return nil
+}
+
+// ErrSecretTooLarge is returned when the data of the secret exceeds the size accepted by the API server.
+var ErrSecretTooLarge = errors.New("the secret is too large")
+
+// checkSecretSize sums up the keys and values like the API server and lists the largest keys
+// which have to be removed to get below v1.MaxSecretSize.
+func checkSecretSize(data map[string][]byte) error {
+	total := 0
+	keys := make([]string, 0, len(data))
+	for k, v := range data {
+		total += len(k) + len(v)
+		keys = append(keys, k)
+	}
+	if total <= v1.MaxSecretSize {
+		return nil
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return len(keys[i])+len(data[keys[i]]) > len(keys[j])+len(data[keys[j]])
+	})
+	var offending []string
+	for excess := total - v1.MaxSecretSize; excess > 0; keys = keys[1:] {
+		size := len(keys[0]) + len(data[keys[0]])
+		offending = append(offending, fmt.Sprintf("%s (%d bytes)", keys[0], size))
+		excess -= size
+	}
+	return fmt.Errorf("%w: the data has %d bytes, the limit is %d bytes, the largest keys are %s",
+		ErrSecretTooLarge, total, v1.MaxSecretSize, strings.Join(offending, ", "))
+}
+
+// SealSecret encrypts the secret with pk and adds the given labels and annotations to the SealedSecret metadata.
+func SealSecret(secret v1.Secret, pk *rsa.PublicKey, labels, annotations map[string]string) ([]byte, error) {
 	codecs := scheme.Codecs
 
 	// Strip read-only server-side ObjectMeta (if present)
@@ -61,11 +270,116 @@ func SealSecret(secret v1.Secret, pk *rsa.PublicKey) ([]byte, error) {
 	secret.SetDeletionTimestamp(nil)
 	secret.DeletionGracePeriodSeconds = nil
 
+	// The values are encrypted by encryptData instead, since NewSealedSecret encrypts them one by one.
+	plaintext := make(map[string][]byte, len(secret.Data)+len(secret.StringData))
+	for k, v := range secret.Data {
+		plaintext[k] = v
+	}
+	for k, v := range secret.StringData {
+		plaintext[k] = []byte(v)
+	}
+	secret.Data, secret.StringData = nil, nil
+	if err := checkSecretSize(plaintext); err != nil {
+		return nil, err
+	}
+
 	sealedSecret, err := ssv1alpha1.NewSealedSecret(codecs, pk, &secret)
 	if err != nil {
 		return nil, fmt.Errorf("unable to seal secret: %w", err)
 	}
+	label := ssv1alpha1.EncryptionLabel(secret.Namespace, secret.Name, ssv1alpha1.SecretScope(&secret))
+	sealedSecret.Spec.EncryptedData, err = encryptData(pk, plaintext, label)
+	if err != nil {
+		return nil, fmt.Errorf("unable to seal secret: %w", err)
+	}
+	for k, v := range labels {
+		if sealedSecret.Labels == nil {
+			sealedSecret.Labels = map[string]string{}
+		}
+		sealedSecret.Labels[k] = v
+	}
+	for k, v := range annotations {
+		if sealedSecret.Annotations == nil {
+			sealedSecret.Annotations = map[string]string{}
+		}
+		sealedSecret.Annotations[k] = v
+	}
 
+	return encodeSealedSecret(codecs, sealedSecret)
+}
+
+// SealRaw encrypts a single value for the given name, namespace and scope, like kubeseal --raw.
+// The returned base64 encoded ciphertext can be used as a value of spec.encryptedData.
+func SealRaw(pk *rsa.PublicKey, value []byte, namespace, name, scope string) (string, error) {
+	var s ssv1alpha1.SealingScope
+	if err := s.Set(scope); err != nil {
+		return "", fmt.Errorf("invalid scope %q: %w", scope, err)
+	}
+	if s < ssv1alpha1.ClusterWideScope && namespace == "" {
+		return "", fmt.Errorf("namespace is required with the %s scope", scope)
+	}
+	if s < ssv1alpha1.NamespaceWideScope && name == "" {
+		return "", fmt.Errorf("name is required with the %s scope", scope)
+	}
+	ciphertext, err := crypto.HybridEncrypt(rand.Reader, pk, value, ssv1alpha1.EncryptionLabel(namespace, name, s))
+	if err != nil {
+		return "", fmt.Errorf("unable to seal value: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// UpdateTemplate decodes the sealed secret, applies update to its template and encodes it again.
+// The encrypted data is left untouched, so no re-sealing is needed.
+func UpdateTemplate(sealedSecret []byte, update func(t *ssv1alpha1.SecretTemplateSpec)) ([]byte, error) {
+	return Update(sealedSecret, func(ss *ssv1alpha1.SealedSecret) {
+		update(&ss.Spec.Template)
+	})
+}
+
+// Update decodes the sealed secret, applies update and encodes it again.
+// update must not change the encrypted data or anything it is bound to, such as the name, namespace and scope.
+func Update(sealedSecret []byte, update func(ss *ssv1alpha1.SealedSecret)) ([]byte, error) {
+	codecs := scheme.Codecs
+
+	var ss ssv1alpha1.SealedSecret
+	if err := runtime.DecodeInto(codecs.UniversalDeserializer(), sealedSecret, &ss); err != nil {
+		return nil, fmt.Errorf("unable to decode sealed secret: %w", err)
+	}
+	update(&ss)
+
+	return encodeSealedSecret(codecs, &ss)
+}
+
+// EncryptedData returns spec.encryptedData of the sealed secret.
+func EncryptedData(sealedSecret []byte) (map[string]string, error) {
+	var ss ssv1alpha1.SealedSecret
+	if err := runtime.DecodeInto(scheme.Codecs.UniversalDeserializer(), sealedSecret, &ss); err != nil {
+		return nil, fmt.Errorf("unable to decode sealed secret: %w", err)
+	}
+	return ss.Spec.EncryptedData, nil
+}
+
+// SealedSecretFingerprints returns the CertFingerprintAnnotation of every SealedSecret in the YAML documents of r.
+// A SealedSecret without the annotation results in an empty fingerprint, other kinds are skipped.
+func SealedSecretFingerprints(r io.Reader) ([]string, error) {
+	var fingerprints []string
+	dec := yaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		var obj metav1.PartialObjectMetadata
+		if err := dec.Decode(&obj); err != nil {
+			if errors.Is(err, io.EOF) {
+				return fingerprints, nil
+			}
+			return nil, err
+		}
+		if obj.Kind != "SealedSecret" {
+			continue
+		}
+		fingerprints = append(fingerprints, obj.Annotations[CertFingerprintAnnotation])
+	}
+}
+
+func encodeSealedSecret(codecs runtimeserializer.CodecFactory, sealedSecret *ssv1alpha1.SealedSecret) ([]byte, error) {
 	prettyEnc, err := prettyEncoder(codecs, runtime.ContentTypeYAML, ssv1alpha1.SchemeGroupVersion)
 	if err != nil {
 		return nil, err
@@ -77,6 +391,52 @@ func SealSecret(secret v1.Secret, pk *rsa.PublicKey) ([]byte, error) {
 	return encodedSealedSecret, nil
 }
 
+// encryptData encrypts every value with pk using a bounded pool of sealWorkers goroutines.
+func encryptData(pk *rsa.PublicKey, data map[string][]byte, label []byte) (map[string]string, error) {
+	type result struct {
+		key, ciphertext string
+		err             error
+	}
+	keys := make(chan string)
+	results := make(chan result)
+
+	var wg sync.WaitGroup
+	for i := 0; i < sealWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keys {
+				ciphertext, err := crypto.HybridEncrypt(rand.Reader, pk, data[key], label)
+				results <- result{key: key, ciphertext: base64.StdEncoding.EncodeToString(ciphertext), err: err}
+			}
+		}()
+	}
+	go func() {
+		for key := range data {
+			keys <- key
+		}
+		close(keys)
+		wg.Wait()
+		close(results)
+	}()
+
+	encryptedData := make(map[string]string, len(data))
+	var err error
+	for r := range results {
+		if r.err != nil {
+			if err == nil {
+				err = fmt.Errorf("unable to encrypt key %s: %w", r.key, r.err)
+			}
+			continue
+		}
+		encryptedData[r.key] = r.ciphertext
+	}
+	if err != nil {
+		return nil, err
+	}
+	return encryptedData, nil
+}
+
 func prettyEncoder(codecs runtimeserializer.CodecFactory, mediaType string, gv runtime.GroupVersioner) (runtime.Encoder, error) {
 	info, ok := runtime.SerializerInfoForMediaType(codecs.SupportedMediaTypes(), mediaType)
 	if !ok {
@@ -2,15 +2,25 @@ package kubeseal
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
 	"github.com/akselleirv/sealedsecret/internal/k8s"
+	ssv1alpha1 "github.com/bitnami-labs/sealed-secrets/pkg/apis/sealed-secrets/v1alpha1"
+	"github.com/bitnami-labs/sealed-secrets/pkg/crypto"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	v1 "k8s.io/api/core/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/yaml"
 	"log"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 const pem = `-----BEGIN CERTIFICATE-----
@@ -63,6 +73,148 @@ func TestFetchPK(t *testing.T) {
 	assert.Equal(t, 65537, pk.E)
 }
 
+func TestFetchCertIsCachedAcrossConcurrentCalls(t *testing.T) {
+	m := K8sClientMock{}
+	m.On(getFunc, context.Background(), "name", "ns", "/v1/cert.pem").Return(pem, nil)
+	certResolver := FetchCert(&m, "name", "ns")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := certResolver(context.Background())
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	m.AssertNumberOfCalls(t, getFunc, 1)
+}
+
+func TestCertFingerprint(t *testing.T) {
+	m := K8sClientMock{}
+	m.On(getFunc, context.Background(), "name", "ns", "/v1/cert.pem").Return(pem, nil)
+	c, err := FetchCert(&m, "name", "ns")(context.Background())
+	assert.Nil(t, err)
+
+	assert.Equal(t, "ae1104b2eb9988458105545d9992c5cc35aa8593e022aace5079a6b1c0f58b5c", CertFingerprint(c))
+}
+
+func TestStaticCert(t *testing.T) {
+	certResolver, err := StaticCert([]byte(pem))
+	assert.Nil(t, err)
+	c, err := certResolver(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "ae1104b2eb9988458105545d9992c5cc35aa8593e022aace5079a6b1c0f58b5c", CertFingerprint(c))
+
+	_, err = StaticCert([]byte("not a certificate"))
+	assert.Error(t, err)
+}
+
+func TestParseCerts(t *testing.T) {
+	certs, err := ParseCerts([]byte(pem))
+	assert.Nil(t, err)
+	assert.Len(t, certs, 1)
+
+	_, err = ParseCerts([]byte("<html><body>404 page not found</body></html>"))
+	assert.ErrorIs(t, err, ErrNotPEM)
+	assert.Contains(t, err.Error(), "<html>")
+
+	_, err = ParseCerts([]byte("-----BEGIN CERTIFICATE-----\ninvalid\n-----END CERTIFICATE-----\n"))
+	assert.ErrorIs(t, err, ErrNotPEM)
+}
+
+func TestNewestCert(t *testing.T) {
+	now := time.Date(2021, 7, 5, 0, 0, 0, 0, time.UTC)
+	expired := &x509.Certificate{NotBefore: now.AddDate(-10, 0, 0), NotAfter: now.AddDate(0, 0, -1)}
+	old := &x509.Certificate{NotBefore: now.AddDate(0, -2, 0), NotAfter: now.AddDate(10, 0, 0)}
+	current := &x509.Certificate{NotBefore: now.AddDate(0, -1, 0), NotAfter: now.AddDate(10, 0, 0)}
+	future := &x509.Certificate{NotBefore: now.AddDate(0, 0, 1), NotAfter: now.AddDate(10, 0, 0)}
+
+	tests := []struct {
+		Name     string
+		Certs    []*x509.Certificate
+		Expected *x509.Certificate
+	}{
+		{
+			Name:     "single certificate",
+			Certs:    []*x509.Certificate{old},
+			Expected: old,
+		},
+		{
+			Name:     "newest active certificate",
+			Certs:    []*x509.Certificate{old, current, future, expired},
+			Expected: current,
+		},
+		{
+			Name:     "newest certificate if none is active",
+			Certs:    []*x509.Certificate{expired, future},
+			Expected: future,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			c, err := newestCert(tc.Certs, now)
+			assert.Nil(t, err)
+			assert.Same(t, tc.Expected, c)
+		})
+	}
+
+	_, err := newestCert(nil, now)
+	assert.Error(t, err)
+}
+
+func TestPinCert(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Fingerprint string
+		ExpectedErr error
+	}{
+		{
+			Name:        "matching fingerprint",
+			Fingerprint: "ae1104b2eb9988458105545d9992c5cc35aa8593e022aace5079a6b1c0f58b5c",
+		},
+		{
+			Name:        "matching colon separated upper case fingerprint",
+			Fingerprint: "AE:11:04:B2:EB:99:88:45:81:05:54:5D:99:92:C5:CC:35:AA:85:93:E0:22:AA:CE:50:79:A6:B1:C0:F5:8B:5C",
+		},
+		{
+			Name:        "mismatching fingerprint",
+			Fingerprint: "0000000000000000000000000000000000000000000000000000000000000000",
+			ExpectedErr: ErrCertFingerprintMismatch,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			m := K8sClientMock{}
+			m.On(getFunc, context.Background(), "name", "ns", "/v1/cert.pem").Return(pem, nil)
+			c, err := PinCert(FetchCert(&m, "name", "ns"), tc.Fingerprint)(context.Background())
+
+			if tc.ExpectedErr != nil {
+				assert.ErrorIs(t, err, tc.ExpectedErr)
+				assert.Nil(t, c)
+				return
+			}
+			assert.Nil(t, err)
+			assert.NotNil(t, c)
+		})
+	}
+}
+
+func TestCheckKeySize(t *testing.T) {
+	m := K8sClientMock{}
+	m.On(getFunc, context.Background(), "name", "ns", "/v1/cert.pem").Return(pem, nil)
+	pk, err := FetchPK(&m, "name", "ns")(context.Background())
+	assert.Nil(t, err)
+
+	assert.Nil(t, CheckKeySize(pk, 2048))
+	assert.Nil(t, CheckKeySize(pk, RecommendedKeySize))
+	assert.ErrorIs(t, CheckKeySize(pk, 8192), ErrKeyTooSmall)
+}
+
 func TestSealSecret(t *testing.T) {
 	sm := k8s.SecretManifest{
 		Name:      "name_aa",
@@ -80,14 +232,16 @@ func TestSealSecret(t *testing.T) {
 
 	secret, err := k8s.CreateSecret(&sm)
 	assert.Nil(t, err)
-	sealedSecretRaw, err := SealSecret(secret, pk)
+	sealedSecretRaw, err := SealSecret(secret, pk, map[string]string{"label_aa": "value_aa"}, map[string]string{"annotation_aa": "value_aa"})
 	assert.Nil(t, err)
 
 	actualSS := struct {
 		Kind     string `yaml:"kind"`
 		Metadata struct {
-			Name      string `yaml:"name"`
-			Namespace string `yaml:"namespace"`
+			Name        string            `yaml:"name"`
+			Namespace   string            `yaml:"namespace"`
+			Labels      map[string]string `yaml:"labels"`
+			Annotations map[string]string `yaml:"annotations"`
 		} `yaml:"metadata"`
 		Spec struct {
 			EncryptedData map[string]string `yaml:"encryptedData"`
@@ -111,6 +265,9 @@ func TestSealSecret(t *testing.T) {
 	assert.Equal(t, sm.Namespace, actualSS.Metadata.Namespace)
 	assert.Equal(t, sm.Namespace, actualSS.Spec.Template.Metadata.Namespace)
 
+	assert.Equal(t, "value_aa", actualSS.Metadata.Labels["label_aa"])
+	assert.Equal(t, "value_aa", actualSS.Metadata.Annotations["annotation_aa"])
+
 	assert.Equal(t, "SealedSecret", actualSS.Kind)
 	assert.Equal(t, sm.Type, actualSS.Spec.Template.Type)
 	if len(actualSS.Spec.EncryptedData["keyAA"]) < 600 {
@@ -119,6 +276,184 @@ func TestSealSecret(t *testing.T) {
 	}
 }
 
+func TestSealSecretEncryptsAllKeys(t *testing.T) {
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	fp, err := crypto.PublicKeyFingerprint(&pk.PublicKey)
+	assert.Nil(t, err)
+
+	data := map[string]interface{}{}
+	for i := 0; i < 50; i++ {
+		data[fmt.Sprintf("key_%d", i)] = fmt.Sprintf("value_%d", i)
+	}
+	secret, err := k8s.CreateSecret(&k8s.SecretManifest{Name: "name_aa", Namespace: "ns_aa", Type: "Opaque", Data: data})
+	assert.Nil(t, err)
+
+	sealedSecretRaw, err := SealSecret(secret, &pk.PublicKey, nil, nil)
+	assert.Nil(t, err)
+
+	actualSS := struct {
+		Spec struct {
+			EncryptedData map[string]string `yaml:"encryptedData"`
+		} `yaml:"spec"`
+	}{}
+	assert.Nil(t, yaml.Unmarshal(sealedSecretRaw, &actualSS))
+	assert.Len(t, actualSS.Spec.EncryptedData, len(data))
+
+	for key, value := range data {
+		ciphertext, err := base64.StdEncoding.DecodeString(actualSS.Spec.EncryptedData[key])
+		assert.Nil(t, err)
+		plaintext, err := crypto.HybridDecrypt(rand.Reader, map[string]*rsa.PrivateKey{fp: pk}, ciphertext, []byte("ns_aa/name_aa"))
+		assert.Nil(t, err)
+		assert.Equal(t, value, string(plaintext))
+	}
+}
+
+func TestCheckSecretSize(t *testing.T) {
+	assert.Nil(t, checkSecretSize(map[string][]byte{"small": make([]byte, 1024)}))
+
+	err := checkSecretSize(map[string][]byte{
+		"small":   make([]byte, 1024),
+		"large_a": make([]byte, 800*1024),
+		"large_b": make([]byte, 600*1024),
+	})
+	assert.ErrorIs(t, err, ErrSecretTooLarge)
+	assert.Contains(t, err.Error(), "large_a (819207 bytes)")
+	assert.NotContains(t, err.Error(), "large_b")
+	assert.NotContains(t, err.Error(), "small")
+}
+
+func TestSealSecretWithScope(t *testing.T) {
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	fp, err := crypto.PublicKeyFingerprint(&pk.PublicKey)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		Scope               string
+		Namespace           string
+		ExpectedLabel       string
+		ExpectedAnnotations map[string]string
+	}{
+		{Scope: "strict", Namespace: "ns_aa", ExpectedLabel: "ns_aa/name_aa"},
+		{Scope: "namespace-wide", Namespace: "ns_aa", ExpectedLabel: "ns_aa", ExpectedAnnotations: map[string]string{ssv1alpha1.SealedSecretNamespaceWideAnnotation: "true"}},
+		{Scope: "cluster-wide", ExpectedLabel: "", ExpectedAnnotations: map[string]string{ssv1alpha1.SealedSecretClusterWideAnnotation: "true"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Scope, func(t *testing.T) {
+			secret, err := k8s.CreateSecret(&k8s.SecretManifest{Name: "name_aa", Namespace: tc.Namespace, Type: "Opaque", Data: map[string]interface{}{"key": "value"}})
+			assert.Nil(t, err)
+			assert.Nil(t, SetScope(&secret, tc.Scope))
+
+			sealedSecretRaw, err := SealSecret(secret, &pk.PublicKey, nil, nil)
+			assert.Nil(t, err)
+
+			actualSS := struct {
+				Metadata struct {
+					Annotations map[string]string `yaml:"annotations"`
+				} `yaml:"metadata"`
+				Spec struct {
+					EncryptedData map[string]string `yaml:"encryptedData"`
+				} `yaml:"spec"`
+			}{}
+			assert.Nil(t, yaml.Unmarshal(sealedSecretRaw, &actualSS))
+			assert.Equal(t, tc.ExpectedAnnotations, actualSS.Metadata.Annotations)
+
+			ciphertext, err := base64.StdEncoding.DecodeString(actualSS.Spec.EncryptedData["key"])
+			assert.Nil(t, err)
+			plaintext, err := crypto.HybridDecrypt(rand.Reader, map[string]*rsa.PrivateKey{fp: pk}, ciphertext, []byte(tc.ExpectedLabel))
+			assert.Nil(t, err)
+			assert.Equal(t, "value", string(plaintext))
+		})
+	}
+
+	secret := v1.Secret{}
+	assert.Error(t, SetScope(&secret, "unknown"))
+}
+
+func TestSealRaw(t *testing.T) {
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	fp, err := crypto.PublicKeyFingerprint(&pk.PublicKey)
+	assert.Nil(t, err)
+
+	sealed, err := SealRaw(&pk.PublicKey, []byte("value_aa"), "ns_aa", "", "namespace-wide")
+	assert.Nil(t, err)
+	ciphertext, err := base64.StdEncoding.DecodeString(sealed)
+	assert.Nil(t, err)
+	plaintext, err := crypto.HybridDecrypt(rand.Reader, map[string]*rsa.PrivateKey{fp: pk}, ciphertext, []byte("ns_aa"))
+	assert.Nil(t, err)
+	assert.Equal(t, "value_aa", string(plaintext))
+
+	_, err = SealRaw(&pk.PublicKey, []byte("value_aa"), "ns_aa", "", "strict")
+	assert.Error(t, err)
+	_, err = SealRaw(&pk.PublicKey, []byte("value_aa"), "", "", "namespace-wide")
+	assert.Error(t, err)
+}
+
+func TestUpdateTemplate(t *testing.T) {
+	m := K8sClientMock{}
+	m.On(getFunc, context.Background(), "name", "ns", "/v1/cert.pem").Return(pem, nil)
+	pk, err := FetchPK(&m, "name", "ns")(context.Background())
+	assert.Nil(t, err)
+
+	secret, err := k8s.CreateSecret(&k8s.SecretManifest{Name: "name_aa", Namespace: "ns_aa", Type: "Opaque", Data: map[string]interface{}{"keyAA": "secret"}})
+	assert.Nil(t, err)
+	sealedSecretRaw, err := SealSecret(secret, pk, nil, nil)
+	assert.Nil(t, err)
+
+	updatedRaw, err := UpdateTemplate(sealedSecretRaw, func(t *ssv1alpha1.SecretTemplateSpec) {
+		t.Type = "type_bb"
+	})
+	assert.Nil(t, err)
+
+	type sealedSecret struct {
+		Spec struct {
+			EncryptedData map[string]string `yaml:"encryptedData"`
+			Template      struct {
+				Type string `yaml:"type"`
+			} `yaml:"template"`
+		} `yaml:"spec"`
+	}
+	var before, after sealedSecret
+	assert.Nil(t, yaml.Unmarshal(sealedSecretRaw, &before))
+	assert.Nil(t, yaml.Unmarshal(updatedRaw, &after))
+
+	assert.Equal(t, "Opaque", before.Spec.Template.Type)
+	assert.Equal(t, "type_bb", after.Spec.Template.Type)
+	assert.Equal(t, before.Spec.EncryptedData, after.Spec.EncryptedData)
+
+	encryptedData, err := EncryptedData(updatedRaw)
+	assert.Nil(t, err)
+	assert.Equal(t, before.Spec.EncryptedData, encryptedData)
+}
+
+func TestSealedSecretFingerprints(t *testing.T) {
+	manifests := `
+apiVersion: bitnami.com/v1alpha1
+kind: SealedSecret
+metadata:
+  name: annotated
+  annotations:
+    sealedsecret-provider/cert-fingerprint: fingerprint_aa
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: not_a_sealed_secret
+---
+apiVersion: bitnami.com/v1alpha1
+kind: SealedSecret
+metadata:
+  name: not_annotated
+`
+	fingerprints, err := SealedSecretFingerprints(strings.NewReader(manifests))
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"fingerprint_aa", ""}, fingerprints)
+}
+
 func TestRequestIsRetriedOnRetryableError(t *testing.T) {
 	const timesToCallFetch = 4
 	type ReturnArgs struct {
@@ -0,0 +1,103 @@
+package provider
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/akselleirv/sealedsecret/internal/kubeseal"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"time"
+)
+
+func dataSourceCertificate() *schema.Resource {
+	return &schema.Resource{
+		Description: "Returns the certificate used for sealing. While the controller rotates its keys it serves several certificates, " +
+			"the newest active one is used for sealing and the others are listed in other_certificates.",
+		ReadContext: dataSourceCertificateRead,
+		Schema: map[string]*schema.Schema{
+			"pem": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The PEM-encoded certificate used for sealing.",
+			},
+			"fingerprint": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The SHA-256 fingerprint of the certificate used for sealing.",
+			},
+			"not_before": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The start of the validity period of the certificate used for sealing, in RFC 3339 format.",
+			},
+			"not_after": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The end of the validity period of the certificate used for sealing, in RFC 3339 format.",
+			},
+			"other_certificates": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The other certificates served by the controller, which are not used for sealing.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"pem": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"fingerprint": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"not_before": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"not_after": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceCertificateRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	provider := meta.(*ProviderConfig)
+
+	current, err := provider.CertResolver(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	certs, err := provider.CertsResolver(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	others := make([]interface{}, 0, len(certs))
+	for _, c := range certs {
+		if c != current {
+			others = append(others, certificateAttributes(c))
+		}
+	}
+
+	d.SetId(kubeseal.CertFingerprint(current))
+	for k, v := range certificateAttributes(current) {
+		d.Set(k, v)
+	}
+	d.Set("other_certificates", others)
+
+	return nil
+}
+
+func certificateAttributes(c *x509.Certificate) map[string]interface{} {
+	return map[string]interface{}{
+		"pem":         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})),
+		"fingerprint": kubeseal.CertFingerprint(c),
+		"not_before":  c.NotBefore.Format(time.RFC3339),
+		"not_after":   c.NotAfter.Format(time.RFC3339),
+	}
+}
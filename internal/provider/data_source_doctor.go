@@ -0,0 +1,121 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"github.com/akselleirv/sealedsecret/internal/kubeseal"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"time"
+)
+
+func dataSourceDoctor() *schema.Resource {
+	return &schema.Resource{
+		Description: "Runs connectivity checks against the Kubernetes API server and the sealed-secret-controller and reports the results.",
+		ReadContext: dataSourceDoctorRead,
+		Schema: map[string]*schema.Schema{
+			"healthy": {
+				Type:        schema.TypeBool,
+				Computed:    true,
+				Description: "True if all checks passed.",
+			},
+			"checks": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The result of each check.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Name of the check.",
+						},
+						"passed": {
+							Type:        schema.TypeBool,
+							Computed:    true,
+							Description: "True if the check passed.",
+						},
+						"message": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Details about the result.",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+type doctorCheck struct {
+	name    string
+	passed  bool
+	message string
+}
+
+// dataSourceDoctorRead never fails on a failing check, the failures are reported in the checks attribute.
+func dataSourceDoctorRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	provider := meta.(*ProviderConfig)
+
+	// without the kubernetes block the certificate is still checked, it may come from controller_cert_pem or controller_url
+	checks := []doctorCheck{checkK8sReachable(ctx, provider)}
+	if checks[0].passed {
+		checks = append(checks, checkControllerCert(ctx, provider))
+	} else {
+		checks = append(checks, doctorCheck{name: "controller_cert", message: "skipped since the Kubernetes API server is unreachable"})
+	}
+
+	healthy := true
+	result := make([]interface{}, 0, len(checks))
+	for _, c := range checks {
+		healthy = healthy && c.passed
+		result = append(result, map[string]interface{}{
+			"name":    c.name,
+			"passed":  c.passed,
+			"message": c.message,
+		})
+	}
+
+	d.SetId(provider.ControllerNamespace + "/" + provider.ControllerName)
+	d.Set("healthy", healthy)
+	d.Set("checks", result)
+
+	return nil
+}
+
+func checkK8sReachable(ctx context.Context, provider *ProviderConfig) doctorCheck {
+	c := doctorCheck{name: "k8s_reachable"}
+	if provider.Client == nil {
+		c.passed = true
+		c.message = "not applicable, the kubernetes block is not configured"
+		return c
+	}
+	if err := provider.Client.Ping(ctx); err != nil {
+		c.message = err.Error()
+		return c
+	}
+	c.passed = true
+	c.message = "the API server is reachable and accepted the credentials"
+	return c
+}
+
+func checkControllerCert(ctx context.Context, provider *ProviderConfig) doctorCheck {
+	c := doctorCheck{name: "controller_cert"}
+	cert, err := provider.CertResolver(ctx)
+	if err != nil {
+		c.message = fmt.Sprintf("unable to fetch the certificate of %s: %s", provider.controller(), err)
+		return c
+	}
+	pk, err := kubeseal.PublicKey(cert)
+	if err != nil {
+		c.message = err.Error()
+		return c
+	}
+	if err := kubeseal.CheckKeySize(pk, provider.MinKeySize); err != nil {
+		c.message = err.Error()
+		return c
+	}
+	c.passed = true
+	c.message = fmt.Sprintf("fetched certificate with fingerprint %s, valid until %s", kubeseal.CertFingerprint(cert), cert.NotAfter.Format(time.RFC3339))
+	return c
+}
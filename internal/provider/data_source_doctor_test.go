@@ -0,0 +1,31 @@
+package provider
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+func TestDoctorWithoutKubernetes(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, dataSourceDoctor().Schema, map[string]interface{}{})
+	provider := testProviderWithKey(&rsa.PublicKey{N: big.NewInt(3233), E: 17})
+
+	assert.Nil(t, dataSourceDoctorRead(context.Background(), d, provider))
+	assert.True(t, d.Get("healthy").(bool))
+	assert.Equal(t, "k8s_reachable", d.Get("checks.0.name"))
+	assert.True(t, d.Get("checks.0.passed").(bool))
+	assert.Equal(t, "controller_cert", d.Get("checks.1.name"))
+	assert.True(t, d.Get("checks.1.passed").(bool))
+
+	provider.CertResolver = func(context.Context) (*x509.Certificate, error) {
+		return nil, errK8sConfigRequired
+	}
+	assert.Nil(t, dataSourceDoctorRead(context.Background(), d, provider))
+	assert.False(t, d.Get("healthy").(bool))
+	assert.False(t, d.Get("checks.1.passed").(bool))
+	assert.Contains(t, d.Get("checks.1.message"), errK8sConfigRequired.Error())
+}
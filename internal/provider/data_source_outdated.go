@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"github.com/akselleirv/sealedsecret/internal/kubeseal"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"os"
+	"path/filepath"
+)
+
+func dataSourceOutdated() *schema.Resource {
+	return &schema.Resource{
+		Description: "Scans a directory for sealed secrets which were not sealed with the controller's current certificate. " +
+			"Requires the sealed secrets to be annotated with the certificate fingerprint (see annotate_cert_fingerprint).",
+		ReadContext: dataSourceOutdatedRead,
+		Schema: map[string]*schema.Schema{
+			"path": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "The directory to scan recursively for .yaml and .yml files.",
+			},
+			"current_fingerprint": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The SHA-256 fingerprint of the controller's current certificate.",
+			},
+			"outdated_files": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Files containing a sealed secret sealed with another certificate, these need to be re-encrypted.",
+			},
+			"unknown_files": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Files containing a sealed secret without the certificate fingerprint annotation.",
+			},
+		},
+	}
+}
+
+func dataSourceOutdatedRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	provider := meta.(*ProviderConfig)
+	root := d.Get("path").(string)
+
+	c, err := provider.CertResolver(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	current := kubeseal.CertFingerprint(c)
+
+	outdated, unknown := []string{}, []string{}
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ext := filepath.Ext(path); info.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		fingerprints, err := kubeseal.SealedSecretFingerprints(f)
+		if err != nil {
+			logDebug(fmt.Sprintf("Skipping %s since it is not valid YAML: %s", path, err))
+			return nil
+		}
+		switch fileStatus(fingerprints, current) {
+		case statusOutdated:
+			outdated = append(outdated, path)
+		case statusUnknown:
+			unknown = append(unknown, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("unable to scan %s: %w", root, err))
+	}
+
+	d.SetId(root)
+	d.Set("current_fingerprint", current)
+	d.Set("outdated_files", outdated)
+	d.Set("unknown_files", unknown)
+
+	return nil
+}
+
+const (
+	statusCurrent = iota
+	statusOutdated
+	statusUnknown
+)
+
+// fileStatus returns statusOutdated if any sealed secret in the file was sealed with another certificate,
+// statusUnknown if any is missing the fingerprint and statusCurrent otherwise.
+func fileStatus(fingerprints []string, current string) int {
+	status := statusCurrent
+	for _, fp := range fingerprints {
+		switch {
+		case fp == "":
+			status = statusUnknown
+		case fp != current:
+			return statusOutdated
+		}
+	}
+	return status
+}
@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"context"
+	"github.com/akselleirv/sealedsecret/internal/kubeseal"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func dataSourceRaw() *schema.Resource {
+	return &schema.Resource{
+		Description: "Seals a single value, like kubeseal --raw, to patch individual encryptedData entries into manifests managed elsewhere. " +
+			"The ciphertext is different on every read since the encryption is randomized.",
+		ReadContext: dataSourceRawRead,
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Description:      "Name of the secret the value belongs to. Required with the strict scope.",
+				ValidateDiagFunc: validateSecretName,
+			},
+			"namespace": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Description:      "Namespace of the secret the value belongs to. Required unless scope is cluster-wide.",
+				ValidateDiagFunc: validateNamespaceName,
+			},
+			"scope": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "strict",
+				Description:  "The sealing scope, one of strict, namespace-wide or cluster-wide.",
+				ValidateFunc: validation.StringInSlice([]string{"strict", "namespace-wide", "cluster-wide"}, false),
+			},
+			"value": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Sensitive:   true,
+				Description: "The value to seal.",
+			},
+			"encrypted_value": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The base64 encoded ciphertext, to be used as a value of spec.encryptedData.",
+			},
+		},
+	}
+}
+
+func dataSourceRawRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	provider := meta.(*ProviderConfig)
+	namespace, name, scope := d.Get("namespace").(string), d.Get("name").(string), d.Get("scope").(string)
+
+	release := provider.acquireOperation()
+	defer release()
+
+	pk, err := fetchPublicKey(ctx, provider.PublicKeyResolver)
+	if err != nil {
+		return certDiagnostics(provider, err)
+	}
+	if err := kubeseal.CheckKeySize(pk, provider.MinKeySize); err != nil {
+		return certDiagnostics(provider, err)
+	}
+
+	encrypted, err := kubeseal.SealRaw(pk, []byte(d.Get("value").(string)), namespace, name, scope)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(namespace + "/" + name)
+	d.Set("encrypted_value", encrypted)
+
+	return nil
+}
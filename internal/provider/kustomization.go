@@ -0,0 +1,115 @@
+package provider
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// kustomizationFileNames are the file names recognized by kustomize, the first one is used for new files.
+var kustomizationFileNames = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// kustomizationMu serializes the updates, since several files in the same directory are written in parallel.
+var kustomizationMu sync.Mutex
+
+// updateKustomization adds or removes resource from the resources list of the kustomization in dir.
+// A missing kustomization is created when adding. The file is edited as a yaml.Node to keep comments and order.
+func updateKustomization(dir, resource string, add bool) error {
+	kustomizationMu.Lock()
+	defer kustomizationMu.Unlock()
+
+	path, content, mode, err := readKustomization(dir)
+	if err != nil {
+		return err
+	}
+	if content == nil {
+		if !add {
+			return nil
+		}
+		content = []byte("apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\n")
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("unable to parse %s: expected a mapping", path)
+	}
+	if !setResource(doc.Content[0], resource, add) {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("unable to encode %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), mode); err != nil {
+		return fmt.Errorf("unable to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// readKustomization returns the path and content of the kustomization in dir, content is nil if there is none.
+func readKustomization(dir string) (string, []byte, os.FileMode, error) {
+	for _, name := range kustomizationFileNames {
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", nil, 0, fmt.Errorf("unable to read %s: %w", path, err)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", nil, 0, fmt.Errorf("unable to read %s: %w", path, err)
+		}
+		return path, b, info.Mode().Perm(), nil
+	}
+	return filepath.Join(dir, kustomizationFileNames[0]), nil, 0644, nil
+}
+
+// setResource adds or removes resource in the resources list of the kustomization and reports whether it changed.
+func setResource(kustomization *yaml.Node, resource string, add bool) bool {
+	var resources *yaml.Node
+	for i := 0; i+1 < len(kustomization.Content); i += 2 {
+		if kustomization.Content[i].Value == "resources" {
+			resources = kustomization.Content[i+1]
+		}
+	}
+	if resources == nil {
+		if !add {
+			return false
+		}
+		resources = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		kustomization.Content = append(kustomization.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "resources"}, resources)
+	}
+	if resources.Kind != yaml.SequenceNode {
+		// resources without a value
+		*resources = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	}
+	// an empty list may have been written as resources: []
+	resources.Style &^= yaml.FlowStyle
+
+	for i, n := range resources.Content {
+		if n.Value == resource {
+			if add {
+				return false
+			}
+			resources.Content = append(resources.Content[:i], resources.Content[i+1:]...)
+			return true
+		}
+	}
+	if !add {
+		return false
+	}
+	resources.Content = append(resources.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: resource})
+	return true
+}
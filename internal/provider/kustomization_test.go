@@ -0,0 +1,35 @@
+package provider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateKustomization(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "kustomization.yaml")
+
+	assert.NoError(t, updateKustomization(dir, "a.yaml", false))
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "nothing to remove, no kustomization is created")
+
+	assert.NoError(t, updateKustomization(dir, "a.yaml", true))
+	b, _ := os.ReadFile(path)
+	assert.Equal(t, "apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\nresources:\n  - a.yaml\n", string(b))
+
+	assert.NoError(t, os.WriteFile(path, []byte("# managed\nresources: []\nnamespace: apps # target\n"), 0600))
+	assert.NoError(t, os.Chmod(path, 0600))
+	assert.NoError(t, updateKustomization(dir, "a.yaml", true))
+	assert.NoError(t, updateKustomization(dir, "b.yaml", true))
+	assert.NoError(t, updateKustomization(dir, "b.yaml", true))
+	b, _ = os.ReadFile(path)
+	assert.Equal(t, "# managed\nresources:\n  - a.yaml\n  - b.yaml\nnamespace: apps # target\n", string(b))
+
+	assert.NoError(t, updateKustomization(dir, "a.yaml", false))
+	b, _ = os.ReadFile(path)
+	assert.Equal(t, "# managed\nresources:\n  - b.yaml\nnamespace: apps # target\n", string(b))
+	info, _ := os.Stat(path)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
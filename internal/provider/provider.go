@@ -2,6 +2,7 @@ package provider
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -9,7 +10,12 @@ import (
 	"github.com/akselleirv/sealedsecret/internal/kubeseal"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"golang.org/x/oauth2"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 func Provider() *schema.Provider {
@@ -18,33 +24,294 @@ func Provider() *schema.Provider {
 			"kubernetes": {
 				Type:        schema.TypeList,
 				MaxItems:    1,
-				Required:    true,
-				Description: "Kubernetes configuration.",
+				Optional:    true,
+				Description: "Kubernetes configuration. Only required when the controller's certificate has to be fetched.",
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
+						"config_path": {
+							Type:          schema.TypeString,
+							Optional:      true,
+							Description:   "Path to the kubeconfig file. The other attributes take precedence over the kubeconfig. Defaults to KUBE_CONFIG_PATH.",
+							ConflictsWith: []string{"kubernetes.0.config_paths", "kubernetes.0.in_cluster"},
+						},
+						"config_paths": {
+							Type:          schema.TypeList,
+							Optional:      true,
+							Elem:          &schema.Schema{Type: schema.TypeString},
+							Description:   "A list of paths to kubeconfig files, merged in the same way as the KUBECONFIG environment variable. Defaults to KUBE_CONFIG_PATHS.",
+							ConflictsWith: []string{"kubernetes.0.in_cluster"},
+						},
+						"config_context": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Context to use from the kubeconfig instead of the current context.",
+							DefaultFunc: schema.EnvDefaultFunc("KUBE_CTX", nil),
+						},
+						"config_context_auth_info": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "User to use from the kubeconfig instead of the one of the context.",
+							DefaultFunc: schema.EnvDefaultFunc("KUBE_CTX_AUTH_INFO", nil),
+						},
+						"config_context_cluster": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Cluster to use from the kubeconfig instead of the one of the context.",
+							DefaultFunc: schema.EnvDefaultFunc("KUBE_CTX_CLUSTER", nil),
+						},
+						"in_cluster": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Default:     false,
+							Description: "Use the service account mounted into the pod when running inside the cluster. The other attributes take precedence over the in-cluster config.",
+						},
 						"host": {
 							Type:        schema.TypeString,
-							Required:    true,
+							Optional:    true,
 							Description: "The hostname (in form of URI) of Kubernetes master.",
-							DefaultFunc: schema.EnvDefaultFunc("HOST", nil),
+							DefaultFunc: schema.MultiEnvDefaultFunc([]string{"KUBE_HOST", "HOST"}, nil),
 						},
 						"client_certificate": {
 							Type:        schema.TypeString,
-							Required:    true,
+							Optional:    true,
 							Description: "PEM-encoded client certificate for TLS authentication.",
-							DefaultFunc: envDefaultFuncDecodeBase64("CLIENT_CERTIFICATE", nil),
+							DefaultFunc: firstDefaultFunc(schema.EnvDefaultFunc("KUBE_CLIENT_CERT_DATA", nil), envDefaultFuncDecodeBase64("CLIENT_CERTIFICATE", nil)),
 						},
 						"client_key": {
 							Type:        schema.TypeString,
-							Required:    true,
+							Optional:    true,
 							Description: "PEM-encoded client certificate key for TLS authentication.",
-							DefaultFunc: envDefaultFuncDecodeBase64("CLIENT_KEY", nil),
+							DefaultFunc: firstDefaultFunc(schema.EnvDefaultFunc("KUBE_CLIENT_KEY_DATA", nil), envDefaultFuncDecodeBase64("CLIENT_KEY", nil)),
 						},
 						"cluster_ca_certificate": {
 							Type:        schema.TypeString,
-							Required:    true,
+							Optional:    true,
 							Description: "PEM-encoded root certificates bundle for TLS authentication.",
-							DefaultFunc: envDefaultFuncDecodeBase64("CLUSTER_CA_CERTIFICATE", nil),
+							DefaultFunc: firstDefaultFunc(schema.EnvDefaultFunc("KUBE_CLUSTER_CA_CERT_DATA", nil), envDefaultFuncDecodeBase64("CLUSTER_CA_CERTIFICATE", nil)),
+						},
+						"tls_server_name": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Server name used for SNI and to verify the API server certificate, e.g. when connecting through a TCP load balancer.",
+							DefaultFunc: schema.EnvDefaultFunc("KUBE_TLS_SERVER_NAME", nil),
+						},
+						"insecure": {
+							Type:          schema.TypeBool,
+							Optional:      true,
+							DefaultFunc:   schema.EnvDefaultFunc("KUBE_INSECURE", false),
+							Description:   "Skip the verification of the API server certificate. Only meant for development clusters.",
+							ConflictsWith: []string{"kubernetes.0.cluster_ca_certificate"},
+						},
+						"token": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Sensitive:   true,
+							Description: "Token to authenticate a service account.",
+							DefaultFunc: schema.EnvDefaultFunc("KUBE_TOKEN", nil),
+						},
+						"username": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Description:  "Username for basic authentication.",
+							DefaultFunc:  schema.EnvDefaultFunc("KUBE_USER", nil),
+							RequiredWith: []string{"kubernetes.0.password"},
+						},
+						"password": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Sensitive:    true,
+							Description:  "Password for basic authentication.",
+							DefaultFunc:  schema.EnvDefaultFunc("KUBE_PASSWORD", nil),
+							RequiredWith: []string{"kubernetes.0.username"},
+						},
+						"exec": {
+							Type:        schema.TypeList,
+							MaxItems:    1,
+							Optional:    true,
+							Description: "Credential plugin used to obtain short-lived credentials, e.g. aws eks get-token or kubelogin.",
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"api_version": {
+										Type:         schema.TypeString,
+										Required:     true,
+										Description:  "The API version of the ExecCredential returned by the plugin.",
+										ValidateFunc: validation.StringInSlice([]string{"client.authentication.k8s.io/v1alpha1", "client.authentication.k8s.io/v1beta1"}, false),
+									},
+									"command": {
+										Type:        schema.TypeString,
+										Required:    true,
+										Description: "The command to execute.",
+									},
+									"args": {
+										Type:        schema.TypeList,
+										Optional:    true,
+										Elem:        &schema.Schema{Type: schema.TypeString},
+										Description: "Arguments passed to the command.",
+									},
+									"env": {
+										Type:        schema.TypeMap,
+										Optional:    true,
+										Elem:        &schema.Schema{Type: schema.TypeString},
+										Description: "Environment variables set when executing the command.",
+									},
+								},
+							},
+						},
+						"proxy_url": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Description:  "URL of the proxy used for requests to the API server. Takes precedence over the proxy environment variables.",
+							DefaultFunc:  schema.EnvDefaultFunc("KUBE_PROXY_URL", nil),
+							ValidateFunc: validation.IsURLWithScheme([]string{"http", "https", "socks5"}),
+						},
+						"qps": {
+							Type:         schema.TypeFloat,
+							Optional:     true,
+							Description:  "Maximum queries per second to the API server. 0 uses the client default of 5.",
+							Default:      0,
+							ValidateFunc: validation.FloatAtLeast(0),
+						},
+						"burst": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							Description:  "Maximum burst of requests to the API server on top of qps. 0 uses the client default of 10.",
+							Default:      0,
+							ValidateFunc: validation.IntAtLeast(0),
+						},
+						"eks": {
+							Type:          schema.TypeList,
+							MaxItems:      1,
+							Optional:      true,
+							Description:   "Generate Amazon EKS tokens with the AWS SDK credentials chain, without the aws CLI. host and cluster_ca_certificate are still required.",
+							ConflictsWith: []string{"kubernetes.0.gke", "kubernetes.0.aks"},
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"cluster_name": {
+										Type:        schema.TypeString,
+										Required:    true,
+										Description: "Name of the EKS cluster.",
+									},
+									"region": {
+										Type:        schema.TypeString,
+										Optional:    true,
+										Description: "AWS region of the EKS cluster.",
+										DefaultFunc: schema.MultiEnvDefaultFunc([]string{"AWS_REGION", "AWS_DEFAULT_REGION"}, nil),
+									},
+									"profile": {
+										Type:        schema.TypeString,
+										Optional:    true,
+										Description: "AWS profile from the shared config and credentials files.",
+									},
+									"role_arn": {
+										Type:        schema.TypeString,
+										Optional:    true,
+										Description: "ARN of an IAM role to assume before generating the token.",
+									},
+								},
+							},
+						},
+						"oidc": {
+							Type:        schema.TypeList,
+							MaxItems:    1,
+							Optional:    true,
+							Description: "Authenticate with OpenID Connect ID tokens. The ID token is refreshed with the refresh token when it expires, so long applies do not fail halfway through.",
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"issuer_url": {
+										Type:        schema.TypeString,
+										Required:    true,
+										Description: "URL of the OpenID Connect issuer, used to discover the token endpoint.",
+									},
+									"client_id": {
+										Type:        schema.TypeString,
+										Required:    true,
+										Description: "The OAuth2 client ID.",
+									},
+									"client_secret": {
+										Type:        schema.TypeString,
+										Optional:    true,
+										Sensitive:   true,
+										Description: "The OAuth2 client secret.",
+									},
+									"refresh_token": {
+										Type:        schema.TypeString,
+										Required:    true,
+										Sensitive:   true,
+										Description: "Refresh token used to obtain new ID tokens.",
+									},
+									"id_token": {
+										Type:        schema.TypeString,
+										Optional:    true,
+										Sensitive:   true,
+										Description: "ID token used until it expires. If not set, a new one is requested right away.",
+									},
+									"issuer_ca_certificate": {
+										Type:        schema.TypeString,
+										Optional:    true,
+										Description: "PEM-encoded root certificates bundle used to verify the issuer.",
+									},
+								},
+							},
+						},
+						"gke": {
+							Type:          schema.TypeList,
+							MaxItems:      1,
+							Optional:      true,
+							Description:   "Obtain Google access tokens from the application default credentials, without gcloud. host and cluster_ca_certificate are still required.",
+							ConflictsWith: []string{"kubernetes.0.aks"},
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"scopes": {
+										Type:        schema.TypeList,
+										Optional:    true,
+										Elem:        &schema.Schema{Type: schema.TypeString},
+										Description: "OAuth2 scopes of the access token. Defaults to the cloud-platform and userinfo.email scopes.",
+									},
+								},
+							},
+						},
+						"aks": {
+							Type:        schema.TypeList,
+							MaxItems:    1,
+							Optional:    true,
+							Description: "Obtain Azure AD tokens for AKS clusters with AAD integration, without az or kubelogin. Uses a service principal if client_secret is set, otherwise the managed identity of the host. host and cluster_ca_certificate are still required.",
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"tenant_id": {
+										Type:        schema.TypeString,
+										Optional:    true,
+										Description: "Azure AD tenant ID of the service principal.",
+										DefaultFunc: schema.EnvDefaultFunc("AZURE_TENANT_ID", nil),
+									},
+									"client_id": {
+										Type:        schema.TypeString,
+										Optional:    true,
+										Description: "Client ID of the service principal or of a user-assigned managed identity.",
+										DefaultFunc: schema.EnvDefaultFunc("AZURE_CLIENT_ID", nil),
+									},
+									"client_secret": {
+										Type:        schema.TypeString,
+										Optional:    true,
+										Sensitive:   true,
+										Description: "Client secret of the service principal.",
+										DefaultFunc: schema.EnvDefaultFunc("AZURE_CLIENT_SECRET", nil),
+									},
+								},
+							},
+						},
+						"max_idle_connections": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							Description:  "Maximum number of idle keep-alive connections kept open to the API server. 0 uses the client default.",
+							Default:      0,
+							ValidateFunc: validation.IntAtLeast(0),
+						},
+						"idle_connection_timeout": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							Description:  "Seconds an idle keep-alive connection to the API server is kept open. 0 uses the client default.",
+							Default:      0,
+							ValidateFunc: validation.IntAtLeast(0),
 						},
 					},
 				},
@@ -55,15 +322,90 @@ func Provider() *schema.Provider {
 				Description: "The name of k8s service for the sealed-secret-controller.",
 				Default:     "sealed-secret-controller-sealed-secrets",
 			},
+			"controller_selector": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Label selector used to discover the controller's service in controller_namespace, e.g. app.kubernetes.io/name=sealed-secrets. Takes precedence over controller_name and requires exactly one matching service.",
+			},
+			"controller_url": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Description:   "URL of the controller when it is exposed outside of the cluster, e.g. through an Ingress. The certificate is fetched from <controller_url>/v1/cert.pem instead of through the API server, so the kubernetes block is not needed.",
+				ConflictsWith: []string{"controller_cert_pem"},
+			},
+			"controller_port": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The name or number of the controller's service port used to fetch the certificate.",
+				Default:     "8080",
+			},
+			"controller_scheme": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "The scheme used by the API server to proxy requests to the controller, either http or https.",
+				Default:      "http",
+				ValidateFunc: validation.StringInSlice([]string{"http", "https"}, false),
+			},
 			"controller_namespace": {
 				Type:        schema.TypeString,
 				Optional:    true,
 				Description: "The namespace the controller is running in.",
 				Default:     "kube-system",
 			},
+			"max_concurrent_operations": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Description:  "Maximum number of certificate fetches and seals running at the same time, independent of Terraform's parallelism. 0 means no limit.",
+				Default:      0,
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+			"pinned_cert_fingerprint": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "SHA-256 fingerprint of the controller's sealing certificate. Sealing fails if the fetched certificate does not match.",
+				Default:     "",
+			},
+			"cert_expiry_warning_days": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Description:  "Emit a warning when the sealing certificate expires within this number of days. 0 disables the warning.",
+				Default:      30,
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+			"min_key_size": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Description:  "Minimum RSA key size in bits of the sealing certificate. A warning is emitted below the recommended 4096 bits.",
+				Default:      2048,
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+			"offline_refresh": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Skip all network access during refresh and keep the values stored in state, so only apply talks to the cluster.",
+				Default:     false,
+			},
+			"controller_cert_pem": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "PEM-encoded certificate of the sealed-secret-controller, as returned by kubeseal --fetch-cert. When set, secrets are sealed offline and the kubernetes block is not needed.",
+			},
+			"ignore_proxy_environment": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Do not use the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables for outbound requests.",
+				Default:     false,
+			},
 		},
 		ConfigureContextFunc: configureProvider,
+		DataSourcesMap: map[string]*schema.Resource{
+			"sealedsecret_certificate": dataSourceCertificate(),
+			"sealedsecret_doctor":      dataSourceDoctor(),
+			"sealedsecret_outdated":    dataSourceOutdated(),
+			"sealedsecret_raw":         dataSourceRaw(),
+		},
 		ResourcesMap: map[string]*schema.Resource{
+			"sealedsecret_file":  resourceFile(),
 			"sealedsecret_local": resourceLocal(),
 		},
 	}
@@ -72,34 +414,277 @@ func Provider() *schema.Provider {
 type ProviderConfig struct {
 	ControllerName      string
 	ControllerNamespace string
-	Client              *k8s.Client
-	PublicKeyResolver   kubeseal.PKResolverFunc
+	// ControllerSelector discovers the controller service by labels instead of ControllerName, if set.
+	ControllerSelector string
+	Client             *k8s.Client
+	CertResolver       kubeseal.CertResolverFunc
+	// CertsResolver returns all certificates of the controller, CertResolver selects the one used for sealing.
+	CertsResolver     kubeseal.CertsResolverFunc
+	PublicKeyResolver kubeseal.PKResolverFunc
+	OfflineRefresh    bool
+	MinKeySize        int
+	// CertExpiryWarning is the remaining validity of the certificate below which a warning is emitted, 0 disables it.
+	CertExpiryWarning time.Duration
+
+	// pinnedFingerprint is also enforced on the certificates overridden by resources.
+	pinnedFingerprint string
+
+	// operations bounds the number of concurrent remote operations, nil means unbounded.
+	operations chan struct{}
 }
 
+// acquireOperation blocks until an operation slot is available and returns a func releasing it.
+func (p *ProviderConfig) acquireOperation() func() {
+	if p.operations == nil {
+		return func() {}
+	}
+	p.operations <- struct{}{}
+	return func() { <-p.operations }
+}
+
+// controller describes the controller service in messages.
+func (p *ProviderConfig) controller() string {
+	if p.ControllerSelector != "" {
+		return fmt.Sprintf("the controller matching %q in %s", p.ControllerSelector, p.ControllerNamespace)
+	}
+	return p.ControllerNamespace + "/" + p.ControllerName
+}
+
+// certResolver returns the provider's resolver, or one for certPEM if a resource overrides the certificate.
+func (p *ProviderConfig) certResolver(certPEM string) (kubeseal.CertResolverFunc, error) {
+	if certPEM == "" {
+		return p.CertResolver, nil
+	}
+	certResolver, err := kubeseal.StaticCert([]byte(certPEM))
+	if err != nil {
+		return nil, err
+	}
+	if p.pinnedFingerprint != "" {
+		certResolver = kubeseal.PinCert(certResolver, p.pinnedFingerprint)
+	}
+	return certResolver, nil
+}
+
+// errK8sConfigRequired is returned when the controller's certificate is needed without a kubernetes block.
+var errK8sConfigRequired = errors.New("either the kubernetes block, controller_url or controller_cert_pem is required to get the certificate of the sealed-secret-controller")
+
 func configureProvider(ctx context.Context, rd *schema.ResourceData) (interface{}, diag.Diagnostics) {
+	c, err := newK8sClient(rd)
+	if err != nil {
+		return nil, diag.FromErr(err)
+	}
+
+	cName := rd.Get("controller_name").(string)
+	cNs := rd.Get("controller_namespace").(string)
+	cSelector := rd.Get("controller_selector").(string)
+
+	certsResolver := func(context.Context) ([]*x509.Certificate, error) {
+		return nil, errK8sConfigRequired
+	}
+	if c != nil {
+		certsResolver = kubeseal.FetchCerts(c, cName, cNs)
+		if cSelector != "" {
+			certsResolver = kubeseal.FetchCerts(&k8s.SelectorClient{Client: c, Selector: cSelector}, cName, cNs)
+		}
+	}
+	if u := rd.Get("controller_url").(string); u != "" {
+		certsResolver = kubeseal.FetchCerts(k8s.NewURLClient(u, rd.Get("ignore_proxy_environment").(bool)), cName, cNs)
+	}
+	if certPEM := rd.Get("controller_cert_pem").(string); certPEM != "" {
+		certsResolver, err = kubeseal.StaticCerts([]byte(certPEM))
+		if err != nil {
+			return nil, diag.FromErr(err)
+		}
+	}
+	certResolver := kubeseal.NewestCert(certsResolver)
+	pin := rd.Get("pinned_cert_fingerprint").(string)
+	if pin != "" {
+		certResolver = kubeseal.PinCert(certResolver, pin)
+	}
+	pc := &ProviderConfig{
+		ControllerName:      cName,
+		ControllerNamespace: cNs,
+		ControllerSelector:  cSelector,
+		Client:              c,
+		CertResolver:        certResolver,
+		CertsResolver:       certsResolver,
+		PublicKeyResolver:   kubeseal.PKResolver(certResolver),
+		OfflineRefresh:      rd.Get("offline_refresh").(bool),
+		MinKeySize:          rd.Get("min_key_size").(int),
+		CertExpiryWarning:   time.Duration(rd.Get("cert_expiry_warning_days").(int)) * 24 * time.Hour,
+		pinnedFingerprint:   pin,
+	}
+	if maxOps := rd.Get("max_concurrent_operations").(int); maxOps > 0 {
+		pc.operations = make(chan struct{}, maxOps)
+	}
+
+	return pc, nil
+}
+
+// newK8sClient returns a nil client if the kubernetes block is not set.
+func newK8sClient(rd *schema.ResourceData) (*k8s.Client, error) {
 	k8sCfg, ok := getMapFromSchemaSet(rd, "kubernetes")
 	if !ok {
-		return nil, diag.FromErr(errors.New("k8s configuration is required"))
+		return nil, nil
+	}
+	configPaths, err := kubeconfigPaths(k8sCfg)
+	if err != nil {
+		return nil, err
 	}
-	c, err := k8s.NewClient(&k8s.Config{
+	ts, err := tokenSource(k8sCfg, rd.Get("ignore_proxy_environment").(bool))
+	if err != nil {
+		return nil, err
+	}
+	inCluster := k8sCfg["in_cluster"].(bool)
+	if !inCluster && len(configPaths) == 0 && k8sCfg["host"].(string) == "" {
+		return nil, errors.New("either host, config_path/config_paths or in_cluster must be set in the kubernetes block")
+	}
+	return k8s.NewClient(&k8s.Config{
+		ConfigPaths: configPaths,
+		ConfigContext: k8s.ConfigContext{
+			Name:     k8sCfg["config_context"].(string),
+			AuthInfo: k8sCfg["config_context_auth_info"].(string),
+			Cluster:  k8sCfg["config_context_cluster"].(string),
+		},
+		InCluster:     inCluster,
 		Host:          k8sCfg["host"].(string),
 		ClusterCACert: []byte(k8sCfg["cluster_ca_certificate"].(string)),
 		ClientCert:    []byte(k8sCfg["client_certificate"].(string)),
 		ClientKey:     []byte(k8sCfg["client_key"].(string)),
+		TLSServerName: k8sCfg["tls_server_name"].(string),
+		Insecure:      k8sCfg["insecure"].(bool),
+		Token:         k8sCfg["token"].(string),
+		Username:      k8sCfg["username"].(string),
+		Password:      k8sCfg["password"].(string),
+		Exec:          execConfig(k8sCfg),
+		OIDC:          oidcConfig(k8sCfg),
+		TokenSource:   ts,
+
+		ProxyURL:               k8sCfg["proxy_url"].(string),
+		IgnoreProxyEnvironment: rd.Get("ignore_proxy_environment").(bool),
+		QPS:                    float32(k8sCfg["qps"].(float64)),
+		Burst:                  k8sCfg["burst"].(int),
+		MaxIdleConnsPerHost:    k8sCfg["max_idle_connections"].(int),
+		IdleConnTimeout:        time.Duration(k8sCfg["idle_connection_timeout"].(int)) * time.Second,
+
+		ControllerScheme: rd.Get("controller_scheme").(string),
+		ControllerPort:   rd.Get("controller_port").(string),
 	})
-	if err != nil {
-		return nil, diag.FromErr(err)
+}
+
+func execConfig(k8sCfg map[string]interface{}) *k8s.ExecConfig {
+	execList := k8sCfg["exec"].([]interface{})
+	if len(execList) == 0 {
+		return nil
 	}
+	exec := execList[0].(map[string]interface{})
 
-	cName := rd.Get("controller_name").(string)
-	cNs := rd.Get("controller_namespace").(string)
+	cfg := &k8s.ExecConfig{
+		APIVersion: exec["api_version"].(string),
+		Command:    exec["command"].(string),
+		Env:        map[string]string{},
+	}
+	for _, arg := range exec["args"].([]interface{}) {
+		cfg.Args = append(cfg.Args, arg.(string))
+	}
+	for k, v := range exec["env"].(map[string]interface{}) {
+		cfg.Env[k] = v.(string)
+	}
+	return cfg
+}
 
-	return &ProviderConfig{
-		ControllerName:      cName,
-		ControllerNamespace: cNs,
-		Client:              c,
-		PublicKeyResolver:   kubeseal.FetchPK(c, cName, cNs),
-	}, nil
+func oidcConfig(k8sCfg map[string]interface{}) *k8s.OIDCConfig {
+	cfg, ok := getBlock(k8sCfg, "oidc")
+	if !ok {
+		return nil
+	}
+	return &k8s.OIDCConfig{
+		IssuerURL:    cfg["issuer_url"].(string),
+		ClientID:     cfg["client_id"].(string),
+		ClientSecret: cfg["client_secret"].(string),
+		RefreshToken: cfg["refresh_token"].(string),
+		IDToken:      cfg["id_token"].(string),
+		IssuerCACert: []byte(cfg["issuer_ca_certificate"].(string)),
+	}
+}
+
+// tokenSource returns nil if no token generating auth helper is configured.
+func tokenSource(k8sCfg map[string]interface{}, ignoreProxyEnvironment bool) (oauth2.TokenSource, error) {
+	if cfg, ok := getBlock(k8sCfg, "eks"); ok {
+		return (&k8s.EKSConfig{
+			ClusterName: cfg["cluster_name"].(string),
+			Region:      cfg["region"].(string),
+			Profile:     cfg["profile"].(string),
+			RoleARN:     cfg["role_arn"].(string),
+
+			IgnoreProxyEnvironment: ignoreProxyEnvironment,
+		}).TokenSource()
+	}
+	if cfg, ok := getBlock(k8sCfg, "gke"); ok {
+		gke := &k8s.GKEConfig{IgnoreProxyEnvironment: ignoreProxyEnvironment}
+		if scopes, ok := cfg["scopes"].([]interface{}); ok {
+			for _, scope := range scopes {
+				gke.Scopes = append(gke.Scopes, scope.(string))
+			}
+		}
+		return gke.TokenSource()
+	}
+	if cfg, ok := getBlock(k8sCfg, "aks"); ok {
+		return (&k8s.AKSConfig{
+			TenantID:     cfg["tenant_id"].(string),
+			ClientID:     cfg["client_id"].(string),
+			ClientSecret: cfg["client_secret"].(string),
+
+			IgnoreProxyEnvironment: ignoreProxyEnvironment,
+		}).TokenSource()
+	}
+	return nil, nil
+}
+
+// getBlock returns the attributes of a nested block with MaxItems 1.
+// An empty block without any attribute set results in an empty map.
+func getBlock(m map[string]interface{}, key string) (map[string]interface{}, bool) {
+	l, _ := m[key].([]interface{})
+	if len(l) == 0 {
+		return nil, false
+	}
+	block, _ := l[0].(map[string]interface{})
+	if block == nil {
+		block = map[string]interface{}{}
+	}
+	return block, true
+}
+
+// kubeconfigPaths returns the kubeconfig paths with a leading ~ expanded to the home directory.
+// KUBE_CONFIG_PATH and KUBE_CONFIG_PATHS are only used if neither the paths nor in_cluster are configured,
+// they are not schema defaults since config_path conflicts with config_paths and in_cluster.
+func kubeconfigPaths(k8sCfg map[string]interface{}) ([]string, error) {
+	var paths []string
+	if p := k8sCfg["config_path"].(string); p != "" {
+		paths = append(paths, p)
+	}
+	for _, p := range k8sCfg["config_paths"].([]interface{}) {
+		paths = append(paths, p.(string))
+	}
+	if len(paths) == 0 && !k8sCfg["in_cluster"].(bool) {
+		if v := os.Getenv("KUBE_CONFIG_PATH"); v != "" {
+			paths = []string{v}
+		} else if v := os.Getenv("KUBE_CONFIG_PATHS"); v != "" {
+			paths = filepath.SplitList(v)
+		}
+	}
+
+	for i, p := range paths {
+		if p != "~" && !strings.HasPrefix(p, "~/") {
+			continue
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("unable to expand %s: %w", p, err)
+		}
+		paths[i] = filepath.Join(home, p[1:])
+	}
+	return paths, nil
 }
 
 func getMapFromSchemaSet(rd *schema.ResourceData, key string) (map[string]interface{}, bool) {
@@ -110,6 +695,19 @@ func getMapFromSchemaSet(rd *schema.ResourceData, key string) (map[string]interf
 	return m.([]interface{})[0].(map[string]interface{}), ok
 }
 
+// firstDefaultFunc returns the first non-nil default of fs.
+func firstDefaultFunc(fs ...schema.SchemaDefaultFunc) schema.SchemaDefaultFunc {
+	return func() (interface{}, error) {
+		for _, f := range fs {
+			v, err := f()
+			if err != nil || v != nil {
+				return v, err
+			}
+		}
+		return nil, nil
+	}
+}
+
 func envDefaultFuncDecodeBase64(k string, dv interface{}) schema.SchemaDefaultFunc {
 	return func() (interface{}, error) {
 		if v := os.Getenv(k); v != "" {
@@ -2,9 +2,11 @@ package provider
 
 import (
 	"context"
+	"encoding/base64"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -49,3 +51,52 @@ func TestProvider(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 }
+
+func TestKubernetesEnvDefaults(t *testing.T) {
+	t.Setenv("CLIENT_KEY", base64.StdEncoding.EncodeToString([]byte("key_from_base64")))
+	t.Setenv("KUBE_CLIENT_KEY_DATA", "")
+	f := firstDefaultFunc(schema.EnvDefaultFunc("KUBE_CLIENT_KEY_DATA", nil), envDefaultFuncDecodeBase64("CLIENT_KEY", nil))
+
+	v, err := f()
+	if err != nil || v != "key_from_base64" {
+		t.Fatalf("expected the decoded CLIENT_KEY, got %v (err: %v)", v, err)
+	}
+
+	t.Setenv("KUBE_CLIENT_KEY_DATA", "key_from_kube_env")
+	v, err = f()
+	if err != nil || v != "key_from_kube_env" {
+		t.Fatalf("expected KUBE_CLIENT_KEY_DATA to take precedence, got %v (err: %v)", v, err)
+	}
+}
+
+func TestKubeconfigPathsFromEnv(t *testing.T) {
+	t.Setenv("KUBE_CONFIG_PATH", "/env/config")
+	t.Setenv("KUBE_CONFIG_PATHS", "")
+
+	for _, k8sCfg := range []map[string]interface{}{
+		{"in_cluster": true},
+		{"config_paths": []interface{}{"/configured/a", "/configured/b"}},
+	} {
+		diags := Provider().Validate(terraform.NewResourceConfigRaw(map[string]interface{}{
+			"kubernetes": []interface{}{k8sCfg},
+		}))
+		if diags.HasError() {
+			t.Fatalf("expected %v to be valid with KUBE_CONFIG_PATH set, got %v", k8sCfg, diags)
+		}
+	}
+
+	tests := []struct {
+		K8sCfg   map[string]interface{}
+		Expected []string
+	}{
+		{K8sCfg: map[string]interface{}{"config_path": "", "config_paths": []interface{}{}, "in_cluster": false}, Expected: []string{"/env/config"}},
+		{K8sCfg: map[string]interface{}{"config_path": "", "config_paths": []interface{}{}, "in_cluster": true}, Expected: nil},
+		{K8sCfg: map[string]interface{}{"config_path": "", "config_paths": []interface{}{"/configured/a"}, "in_cluster": false}, Expected: []string{"/configured/a"}},
+	}
+	for _, tc := range tests {
+		paths, err := kubeconfigPaths(tc.K8sCfg)
+		if err != nil || !reflect.DeepEqual(paths, tc.Expected) {
+			t.Fatalf("expected %v for %v, got %v (err: %v)", tc.Expected, tc.K8sCfg, paths, err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+func resourceFile() *schema.Resource {
+	return &schema.Resource{
+		Description:   "Writes a sealed secret manifest to a local file, e.g. into a repository checked out by the pipeline.",
+		CreateContext: resourceFileCreate,
+		ReadContext:   resourceFileRead,
+		UpdateContext: resourceFileUpdate,
+		DeleteContext: resourceFileDelete,
+		Schema: map[string]*schema.Schema{
+			"filename": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "Path of the file to write.",
+			},
+			"content": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "The sealed manifest to write, e.g. yaml_content of sealedsecret_local.",
+			},
+			"file_permission": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Default:          "0644",
+				ValidateDiagFunc: validateFileMode,
+				Description:      "Permissions of the file as an octal string.",
+			},
+			"directory_permission": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Default:          "0755",
+				ValidateDiagFunc: validateFileMode,
+				Description:      "Permissions of the directories created for the file as an octal string.",
+			},
+			"create_directories": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "Create the missing parent directories of the file.",
+			},
+			"update_kustomization": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Add the file to the resources of the kustomization.yaml in the same directory, and remove it on destroy. The kustomization.yaml is created if missing.",
+			},
+		},
+	}
+}
+
+func resourceFileCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	if diags := writeFile(d); diags != nil {
+		return diags
+	}
+	filename := d.Get("filename").(string)
+	if d.Get("update_kustomization").(bool) {
+		if err := updateKustomization(filepath.Dir(filename), filepath.Base(filename), true); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	d.SetId(hashContent(d.Get("content").(string)))
+	return nil
+}
+
+// resourceFileUpdate rewrites the file in place, e.g. after a re-seal, so its entry in the kustomization is kept as is.
+func resourceFileUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	if diags := writeFile(d); diags != nil {
+		return diags
+	}
+	d.SetId(hashContent(d.Get("content").(string)))
+	return nil
+}
+
+func writeFile(d *schema.ResourceData) diag.Diagnostics {
+	filename := d.Get("filename").(string)
+	fileMode, _ := strconv.ParseUint(d.Get("file_permission").(string), 8, 32)
+	dirMode, _ := strconv.ParseUint(d.Get("directory_permission").(string), 8, 32)
+
+	if d.Get("create_directories").(bool) {
+		if err := os.MkdirAll(filepath.Dir(filename), os.FileMode(dirMode)); err != nil {
+			return diag.Errorf("unable to create the directory of %s: %s", filename, err)
+		}
+	}
+	if err := os.WriteFile(filename, []byte(d.Get("content").(string)), os.FileMode(fileMode)); err != nil {
+		return diag.Errorf("unable to write %s: %s", filename, err)
+	}
+	// WriteFile only applies the mode to new files
+	if err := os.Chmod(filename, os.FileMode(fileMode)); err != nil {
+		return diag.Errorf("unable to set the permissions of %s: %s", filename, err)
+	}
+	return nil
+}
+
+// resourceFileRead removes the resource from the state if the file was deleted, so it is written again.
+// If the file was changed outside of Terraform, the changed content plans an update.
+func resourceFileRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	filename := d.Get("filename").(string)
+	b, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		logDebug("The file " + filename + " does not exist anymore")
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return diag.Errorf("unable to read %s: %s", filename, err)
+	}
+	if hashContent(string(b)) != d.Id() {
+		logDebug("The file " + filename + " was changed outside of Terraform")
+		d.Set("content", string(b))
+	}
+	return nil
+}
+
+func resourceFileDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	filename := d.Get("filename").(string)
+	if err := os.Remove(filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return diag.Errorf("unable to delete %s: %s", filename, err)
+	}
+	if d.Get("update_kustomization").(bool) {
+		if err := updateKustomization(filepath.Dir(filename), filepath.Base(filename), false); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	d.SetId("")
+	return nil
+}
+
+func hashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
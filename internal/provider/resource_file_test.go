@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"context"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResourceFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "secrets", "secret.yaml")
+	d := schema.TestResourceDataRaw(t, resourceFile().Schema, map[string]interface{}{
+		"filename":        filename,
+		"content":         "kind: SealedSecret",
+		"file_permission": "0600",
+	})
+
+	assert.Nil(t, resourceFileCreate(context.Background(), d, nil))
+	b, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, "kind: SealedSecret", string(b))
+	info, err := os.Stat(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	assert.Nil(t, resourceFileRead(context.Background(), d, nil))
+	assert.NotEmpty(t, d.Id())
+
+	assert.NoError(t, os.WriteFile(filename, []byte("changed"), 0600))
+	assert.Nil(t, resourceFileRead(context.Background(), d, nil))
+	assert.Equal(t, "changed", d.Get("content"), "a changed file must plan an update")
+
+	assert.Nil(t, resourceFileDelete(context.Background(), d, nil))
+	_, err = os.Stat(filename)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestResourceFileUpdateKeepsKustomization(t *testing.T) {
+	dir := t.TempDir()
+	kustomization := filepath.Join(dir, "kustomization.yaml")
+	assert.NoError(t, os.WriteFile(kustomization, []byte("resources:\n  - a.yaml\n  - b.yaml\n"), 0644))
+	filename := filepath.Join(dir, "a.yaml")
+	config := map[string]interface{}{
+		"filename":             filename,
+		"content":              "sealed_aa",
+		"update_kustomization": true,
+	}
+
+	diff, err := resourceFile().Diff(context.Background(), nil, terraform.NewResourceConfigRaw(config), nil)
+	assert.NoError(t, err)
+	state, diags := resourceFile().Apply(context.Background(), nil, diff, nil)
+	assert.Nil(t, diags)
+
+	config["content"] = "sealed_bb"
+	diff, err = resourceFile().Diff(context.Background(), state, terraform.NewResourceConfigRaw(config), nil)
+	assert.NoError(t, err)
+	assert.False(t, diff.RequiresNew(), "a re-seal must not replace the file")
+	_, diags = resourceFile().Apply(context.Background(), state, diff, nil)
+	assert.Nil(t, diags)
+
+	b, _ := os.ReadFile(filename)
+	assert.Equal(t, "sealed_bb", string(b))
+	b, _ = os.ReadFile(kustomization)
+	assert.Equal(t, "resources:\n  - a.yaml\n  - b.yaml\n", string(b))
+}
@@ -4,15 +4,24 @@ import (
 	"context"
 	"crypto/rsa"
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/akselleirv/sealedsecret/internal/k8s"
 	"github.com/akselleirv/sealedsecret/internal/kubeseal"
+	ssv1alpha1 "github.com/bitnami-labs/sealed-secrets/pkg/apis/sealed-secrets/v1alpha1"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	v1 "k8s.io/api/core/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	"log"
+	"os"
+	"sort"
 	"time"
 )
 
@@ -20,84 +29,291 @@ func resourceLocal() *schema.Resource {
 	return &schema.Resource{
 		Description:   "Creates a sealed secret and store it in yaml_content.",
 		ReadContext:   resourceLocalRead,
-		UpdateContext: resourceLocalRead,
+		UpdateContext: resourceLocalUpdate,
 		CreateContext: resourceLocalCreate,
+		SchemaVersion: 1,
+		StateUpgraders: []schema.StateUpgrader{
+			{
+				Version: 0,
+				Type:    resourceLocalV0().CoreConfigSchema().ImpliedType(),
+				Upgrade: resourceLocalStateUpgradeV0,
+			},
+		},
 		DeleteContext: func(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 			d.SetId("")
 			return nil
 		},
+		CustomizeDiff: customdiff.All(
+			customdiff.ComputedIf("yaml_content", func(ctx context.Context, d *schema.ResourceDiff, meta interface{}) bool {
+				return sealedAttributesChanged(d) || hasChange(d, templateMetadataAttributes...)
+			}),
+			customdiff.ComputedIf("encrypted_data", func(ctx context.Context, d *schema.ResourceDiff, meta interface{}) bool {
+				return sealedAttributesChanged(d)
+			}),
+			validateNamespace,
+			validateServiceAccountToken,
+			hashDataFromFilesDiff,
+			resealInPlaceOnKeyRotation,
+		),
 		Schema: map[string]*schema.Schema{
 			"name": {
-				Type:        schema.TypeString,
-				Required:    true,
-				Description: "Name of the secret, must be unique.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				Description:      "Name of the secret, must be unique. Either name or secret_yaml is required.",
+				ExactlyOneOf:     []string{"name", "secret_yaml"},
+				ValidateDiagFunc: validateSecretName,
+			},
+			"secret_yaml": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Sensitive:     true,
+				Description:   "A complete v1 Secret manifest which is sealed as is, e.g. to migrate existing plaintext manifests.",
+				ConflictsWith: []string{"namespace", "type", "data", "binary_data", "data_from_files", "secret_labels", "secret_annotations"},
 			},
 			"namespace": {
-				Type:        schema.TypeString,
-				Required:    true,
-				Description: "Namespace of the secret.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				Description:      "Namespace of the secret. Required unless scope is cluster-wide.",
+				ValidateDiagFunc: validateNamespaceName,
+			},
+			"scope": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "strict",
+				Description:  "The sealing scope, as with kubeseal --scope. strict binds the secret to its name and namespace, namespace-wide only to its namespace and cluster-wide allows it to be unsealed in any namespace.",
+				ValidateFunc: validation.StringInSlice([]string{"strict", "namespace-wide", "cluster-wide"}, false),
 			},
 			"type": {
 				Type:        schema.TypeString,
 				Optional:    true,
 				Default:     "Opaque",
-				Description: "The secret type (ex. Opaque). Default type is Opaque.",
+				Description: "The secret type (ex. Opaque). Default type is Opaque. The type kubernetes.io/service-account-token requires the kubernetes.io/service-account.name annotation in secret_annotations.",
 			},
 			"data": {
+				Type:             schema.TypeMap,
+				Optional:         true,
+				Sensitive:        true,
+				Description:      "Key/value pairs to populate the secret. The value will be base64 encoded",
+				DiffSuppressFunc: suppressHashedValuesDiff,
+				ValidateDiagFunc: validateSecretKeys,
+			},
+			"controller_cert_pem": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "PEM-encoded certificate used to seal this secret, overriding the certificate of the provider.",
+			},
+			"binary_data": {
+				Type:             schema.TypeMap,
+				Optional:         true,
+				Sensitive:        true,
+				Elem:             &schema.Schema{Type: schema.TypeString},
+				Description:      "Key/value pairs with base64 encoded values, decoded before sealing. Use it for binary content such as keystores, e.g. with filebase64().",
+				DiffSuppressFunc: suppressHashedValuesDiff,
+				ValidateDiagFunc: validateSecretKeys,
+			},
+			"store_hashes_only": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Store SHA-256 hashes of the values of data and binary_data in the state instead of the plaintext. Changes are detected by comparing the hashes. A key rotation or changed contents of data_from_files then replace the resource, since only the plan of a new resource contains the plaintext.",
+			},
+			"data_from_files": {
+				Type:             schema.TypeMap,
+				Optional:         true,
+				Elem:             &schema.Schema{Type: schema.TypeString},
+				Description:      "Keys mapped to paths of files whose contents are sealed. The files are read at apply time and only a hash of their contents is stored in the state.",
+				ValidateDiagFunc: validateSecretKeys,
+			},
+			"data_from_files_hash": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The SHA-256 hash of the contents of data_from_files, used to detect changed files.",
+			},
+			"secret_labels": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Labels of the secret created by the controller, rendered into spec.template.metadata.",
+			},
+			"secret_annotations": {
 				Type:        schema.TypeMap,
 				Optional:    true,
-				Sensitive:   true,
-				Description: "Key/value pairs to populate the secret. The value will be base64 encoded",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Annotations of the secret created by the controller, rendered into spec.template.metadata.",
+			},
+			"labels": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Labels of the SealedSecret object itself, e.g. for pruning policies.",
+			},
+			"annotations": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Annotations of the SealedSecret object itself, e.g. for Argo CD sync waves.",
+			},
+			"annotate_cert_fingerprint": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     false,
+				Description: "Add an annotation to the sealed secret with the SHA-256 fingerprint of the certificate used for sealing.",
+			},
+			"reseal_in_place": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Re-seal the secret as an update when the public key changes, instead of destroying and creating the resource.",
 			},
 			"yaml_content": {
 				Type:        schema.TypeString,
 				Computed:    true,
 				Description: "The produced sealed secret yaml file.",
 			},
+			"encrypted_data": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "The encrypted values by key, as in spec.encryptedData of yaml_content, e.g. to template them into a Helm chart.",
+			},
 			"public_key_hash": {
 				Type:        schema.TypeString,
 				Computed:    true,
-				ForceNew:    true,
-				Description: "The public key hashed to detect if the public key changes.",
+				Description: "The SHA-256 hash of the public key, used to detect if the public key changes.",
 			},
 		},
 	}
 }
 
+// sealedAttributes are encrypted into the sealed secret, changing them requires re-sealing.
+var sealedAttributes = []string{"name", "secret_yaml", "namespace", "scope", "data", "binary_data", "data_from_files", "data_from_files_hash", "controller_cert_pem"}
+
+// templateMetadataAttributes only end up in the metadata of the sealed secret or its template and are patched without re-sealing.
+var templateMetadataAttributes = []string{"type", "secret_labels", "secret_annotations", "labels", "annotations"}
+
+// hasChange reports if any of the keys changed, for both *schema.ResourceData and *schema.ResourceDiff.
+func hasChange(d interface{ HasChange(string) bool }, keys ...string) bool {
+	for _, k := range keys {
+		if d.HasChange(k) {
+			return true
+		}
+	}
+	return false
+}
+
 // resourceLocalRead creates only a hash of the public key.
 // If the hash changes then the resource is forced recreated.
+// With offline refresh the stored hash is kept as is.
 func resourceLocalRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	provider := meta.(*ProviderConfig)
-	pk, err := fetchPublicKey(ctx, provider.PublicKeyResolver)
+	if d.Get("scope").(string) == "" {
+		// resources created before the scope attribute existed were sealed with the strict scope
+		d.Set("scope", "strict")
+	}
+	if provider.OfflineRefresh {
+		logDebug("Offline refresh, keeping the stored public key hash for " + secretName(d))
+		d.SetId(secretName(d))
+		return nil
+	}
+
+	certResolver, err := provider.certResolver(d.Get("controller_cert_pem").(string))
 	if err != nil {
 		return diag.FromErr(err)
 	}
-	d.SetId(d.Get("name").(string))
+
+	release := provider.acquireOperation()
+	defer release()
+
+	start := time.Now()
+	pk, err := fetchPublicKey(ctx, kubeseal.PKResolver(certResolver))
+	if err != nil {
+		return certDiagnostics(provider, err)
+	}
+	logTiming("cert_fetch", secretName(d), start)
+
+	diags := certExpiryDiagnostics(ctx, certResolver, provider.CertExpiryWarning)
+
+	d.SetId(secretName(d))
 	d.Set("data", d.Get("data").(map[string]interface{}))
+	if _, ok := d.GetOk("encrypted_data"); !ok && d.Get("yaml_content").(string) != "" {
+		// resources created before encrypted_data existed
+		if encryptedData, err := kubeseal.EncryptedData([]byte(d.Get("yaml_content").(string))); err == nil {
+			d.Set("encrypted_data", encryptedData)
+		}
+	}
 
 	newPkHash := hashPublicKey(pk)
-	if oldPkHash, ok := d.GetOk("public_key_hash"); ok && oldPkHash.(string) != newPkHash {
+	if oldPkHash, ok := d.GetOk("public_key_hash"); ok && oldPkHash.(string) != newPkHash && oldPkHash.(string) != legacyHashPublicKey(pk) {
+		if d.Get("reseal_in_place").(bool) {
+			// the old hash is kept, so resealInPlaceOnKeyRotation plans an update
+			logDebug("The public key changed, planning to re-seal " + secretName(d) + " in place")
+			return diags
+		}
 		d.SetId("")
 	}
 	d.Set("public_key_hash", newPkHash)
 
-	return nil
+	return diags
 }
 
 func resourceLocalCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	provider := meta.(*ProviderConfig)
-	name := d.Get("name").(string)
+	name := secretName(d)
 
 	logDebug("Creating sealed secret " + name)
 	k8sSecret, err := createK8sSecret(d)
 	if err != nil {
 		return diag.FromErr(err)
 	}
-	pk, err := fetchPublicKey(ctx, provider.PublicKeyResolver)
+
+	certResolver, err := provider.certResolver(d.Get("controller_cert_pem").(string))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	release := provider.acquireOperation()
+	defer release()
+
+	start := time.Now()
+	pk, err := fetchPublicKey(ctx, kubeseal.PKResolver(certResolver))
+	if err != nil {
+		return certDiagnostics(provider, err)
+	}
+	logTiming("cert_fetch", name, start)
+
+	diags := certExpiryDiagnostics(ctx, certResolver, provider.CertExpiryWarning)
+	if err := kubeseal.CheckKeySize(pk, provider.MinKeySize); err != nil {
+		return certDiagnostics(provider, err)
+	}
+	if pk.N.BitLen() < kubeseal.RecommendedKeySize {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "Sealing key is smaller than recommended",
+			Detail:   fmt.Sprintf("The sealing key has %d bits, %d bits or more is recommended.", pk.N.BitLen(), kubeseal.RecommendedKeySize),
+		})
+	}
+
+	annotations := stringMap(d.Get("annotations"))
+	if d.Get("annotate_cert_fingerprint").(bool) {
+		c, err := certResolver(ctx)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[kubeseal.CertFingerprintAnnotation] = kubeseal.CertFingerprint(c)
+	}
+
+	start = time.Now()
+	sealedSecret, err := kubeseal.SealSecret(k8sSecret, pk, stringMap(d.Get("labels")), annotations)
 	if err != nil {
 		return diag.FromErr(err)
 	}
-	sealedSecret, err := kubeseal.SealSecret(k8sSecret, pk)
+	logTiming("seal", name, start)
+
+	encryptedData, err := kubeseal.EncryptedData(sealedSecret)
 	if err != nil {
 		return diag.FromErr(err)
 	}
@@ -105,14 +321,220 @@ func resourceLocalCreate(ctx context.Context, d *schema.ResourceData, meta inter
 	logDebug("Successfully created sealed secret " + name)
 
 	d.SetId(name)
-	d.Set("data", d.Get("data").(map[string]interface{}))
+	if d.Get("store_hashes_only").(bool) {
+		d.Set("data", hashValues(d.Get("data").(map[string]interface{})))
+		d.Set("binary_data", hashValues(d.Get("binary_data").(map[string]interface{})))
+	} else {
+		d.Set("data", d.Get("data").(map[string]interface{}))
+	}
 	d.Set("yaml_content", string(sealedSecret))
+	d.Set("encrypted_data", encryptedData)
 	d.Set("public_key_hash", hashPublicKey(pk))
 
+	return diags
+}
+
+// validateNamespace requires the namespace unless the scope is cluster-wide, where it is not part of the encryption label.
+func validateNamespace(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.Get("secret_yaml").(string) != "" || !d.NewValueKnown("secret_yaml") {
+		return nil
+	}
+	if d.Get("scope").(string) != "cluster-wide" && d.Get("namespace").(string) == "" && d.NewValueKnown("namespace") {
+		return fmt.Errorf("namespace is required unless scope is cluster-wide")
+	}
+	return nil
+}
+
+// validateServiceAccountToken requires the service account name annotation, which the API server needs to populate the token.
+func validateServiceAccountToken(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.Get("type").(string) != k8s.ServiceAccountTokenType || !d.NewValueKnown("secret_annotations") {
+		return nil
+	}
+	if stringMap(d.Get("secret_annotations"))[k8s.ServiceAccountNameAnnotation] == "" {
+		return fmt.Errorf("secret_annotations must contain %s with type %s", k8s.ServiceAccountNameAnnotation, k8s.ServiceAccountTokenType)
+	}
+	return nil
+}
+
+// hashDataFromFilesDiff plans a re-seal if the contents of data_from_files changed.
+// If a file can not be read yet, e.g. since it is created during the apply, the hash is unknown until the apply.
+// The outputs of the re-seal are marked as computed here, since the ComputedIf checks do not see the new hash.
+func hashDataFromFilesDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if !d.NewValueKnown("data_from_files") {
+		if err := d.SetNewComputed("data_from_files_hash"); err != nil {
+			return err
+		}
+		return setResealComputed(d)
+	}
+	files, err := readDataFromFiles(stringMap(d.Get("data_from_files")))
+	if err != nil {
+		logDebug("Unable to read data_from_files during plan: " + err.Error())
+		if err := d.SetNewComputed("data_from_files_hash"); err != nil {
+			return err
+		}
+		if err := forceNewWithHashedValues(d, "data_from_files_hash"); err != nil {
+			return err
+		}
+		return setResealComputed(d)
+	}
+	if h := hashDataFromFiles(files); h != d.Get("data_from_files_hash").(string) {
+		if err := d.SetNew("data_from_files_hash", h); err != nil {
+			return err
+		}
+		if err := forceNewWithHashedValues(d, "data_from_files_hash"); err != nil {
+			return err
+		}
+		return setResealComputed(d)
+	}
+	return nil
+}
+
+// setResealComputed marks the attributes which are replaced by a re-seal as known after apply.
+func setResealComputed(d *schema.ResourceDiff) error {
+	if err := d.SetNewComputed("yaml_content"); err != nil {
+		return err
+	}
+	return d.SetNewComputed("encrypted_data")
+}
+
+// resealInPlaceOnKeyRotation plans a re-seal as an update if reseal_in_place is set and the public key changed.
+// The plan shows the change of public_key_hash.
+func resealInPlaceOnKeyRotation(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	provider := meta.(*ProviderConfig)
+	if d.Id() == "" || !d.Get("reseal_in_place").(bool) || provider.OfflineRefresh {
+		return nil
+	}
+	certResolver, err := provider.certResolver(d.Get("controller_cert_pem").(string))
+	if err != nil {
+		return err
+	}
+
+	release := provider.acquireOperation()
+	defer release()
+
+	pk, err := fetchPublicKey(ctx, kubeseal.PKResolver(certResolver))
+	if err != nil {
+		return diagnosticsError(certDiagnostics(provider, err))
+	}
+	if newPkHash := hashPublicKey(pk); newPkHash != d.Get("public_key_hash").(string) && legacyHashPublicKey(pk) != d.Get("public_key_hash").(string) {
+		if err := d.SetNew("public_key_hash", newPkHash); err != nil {
+			return err
+		}
+		if err := forceNewWithHashedValues(d, "public_key_hash"); err != nil {
+			return err
+		}
+		return setResealComputed(d)
+	}
+	return nil
+}
+
+// resourceLocalUpdate re-seals the secret if any of the sealed attributes changed.
+// Otherwise only the metadata is patched and the existing ciphertext is kept.
+func resourceLocalUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	if resealRequired(d) {
+		return resourceLocalCreate(ctx, d, meta)
+	}
+	if o, n := d.GetChange("store_hashes_only"); !o.(bool) && n.(bool) {
+		logDebug("Replacing the values of " + secretName(d) + " in the state with their hashes")
+		d.Set("data", hashValues(d.Get("data").(map[string]interface{})))
+		d.Set("binary_data", hashValues(d.Get("binary_data").(map[string]interface{})))
+	}
+	if !hasChange(d, templateMetadataAttributes...) {
+		return nil
+	}
+
+	name := secretName(d)
+	logDebug("Updating the metadata of sealed secret " + name)
+	// the scope and fingerprint annotations depend on the sealed attributes and are kept as is
+	scopeAnnotations := []string{ssv1alpha1.SealedSecretNamespaceWideAnnotation, ssv1alpha1.SealedSecretClusterWideAnnotation}
+	sealedSecret, err := kubeseal.Update([]byte(d.Get("yaml_content").(string)), func(ss *ssv1alpha1.SealedSecret) {
+		ss.Labels = stringMap(d.Get("labels"))
+		ss.Annotations = keepAnnotations(stringMap(d.Get("annotations")), ss.Annotations, append(scopeAnnotations, kubeseal.CertFingerprintAnnotation)...)
+		if d.Get("secret_yaml").(string) != "" {
+			// the template metadata is part of secret_yaml
+			return
+		}
+		ss.Spec.Template.Type = v1.SecretType(d.Get("type").(string))
+		ss.Spec.Template.Labels = stringMap(d.Get("secret_labels"))
+		ss.Spec.Template.Annotations = keepAnnotations(stringMap(d.Get("secret_annotations")), ss.Spec.Template.Annotations, scopeAnnotations...)
+	})
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.Set("yaml_content", string(sealedSecret))
+
 	return nil
 }
 
+// resealRequired reports if the ciphertext has to be replaced.
+func resealRequired(d *schema.ResourceData) bool {
+	return sealedAttributesChanged(d) || d.HasChange("public_key_hash") || requiresResealOnTypeChange(d)
+}
+
+// sealedAttributesChanged is like hasChange for sealedAttributes, but ignores data and binary_data if the stored
+// hashes of store_hashes_only match the new values. These only differ in the state, e.g. when it is turned off.
+func sealedAttributesChanged(d interface {
+	HasChange(string) bool
+	GetChange(string) (interface{}, interface{})
+}) bool {
+	for _, k := range sealedAttributes {
+		if !d.HasChange(k) {
+			continue
+		}
+		if k == "data" || k == "binary_data" {
+			o, n := d.GetChange(k)
+			if hashedValuesMatch(o.(map[string]interface{}), n.(map[string]interface{})) {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// keepAnnotations copies the keys present in old to annotations.
+func keepAnnotations(annotations, old map[string]string, keys ...string) map[string]string {
+	for _, k := range keys {
+		if v, ok := old[k]; ok {
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[k] = v
+		}
+	}
+	return annotations
+}
+
+// requiresResealOnTypeChange reports if the type changed to or from a type where the data is encoded differently.
+func requiresResealOnTypeChange(d *schema.ResourceData) bool {
+	o, n := d.GetChange("type")
+	return o.(string) != n.(string) && (o.(string) == k8s.DockerConfigJSONType || n.(string) == k8s.DockerConfigJSONType)
+}
+
+// secretName returns the name of the secret, which is taken from secret_yaml if set.
+func secretName(d *schema.ResourceData) string {
+	if secretYAML := d.Get("secret_yaml").(string); secretYAML != "" {
+		secret, err := k8s.ParseSecret([]byte(secretYAML))
+		if err != nil {
+			return ""
+		}
+		return secret.Name
+	}
+	return d.Get("name").(string)
+}
+
 func createK8sSecret(d *schema.ResourceData) (v1.Secret, error) {
+	if secretYAML := d.Get("secret_yaml").(string); secretYAML != "" {
+		secret, err := k8s.ParseSecret([]byte(secretYAML))
+		if err != nil {
+			return v1.Secret{}, err
+		}
+		if err := kubeseal.SetScope(&secret, d.Get("scope").(string)); err != nil {
+			return v1.Secret{}, err
+		}
+		return secret, nil
+	}
+
 	rawSecret := k8s.SecretManifest{
 		Name:      d.Get("name").(string),
 		Namespace: d.Get("namespace").(string),
@@ -122,7 +544,167 @@ func createK8sSecret(d *schema.ResourceData) (v1.Secret, error) {
 		rawSecret.Data = dataRaw.(map[string]interface{})
 	}
 
-	return k8s.CreateSecret(&rawSecret)
+	secret, err := k8s.CreateSecret(&rawSecret)
+	if err != nil {
+		return v1.Secret{}, err
+	}
+	binaryData, err := decodeBinaryData(stringMap(d.Get("binary_data")))
+	if err != nil {
+		return v1.Secret{}, err
+	}
+	if err := addData(&secret, binaryData); err != nil {
+		return v1.Secret{}, err
+	}
+	files, err := readDataFromFiles(stringMap(d.Get("data_from_files")))
+	if err != nil {
+		return v1.Secret{}, err
+	}
+	if err := addData(&secret, files); err != nil {
+		return v1.Secret{}, err
+	}
+	d.Set("data_from_files_hash", hashDataFromFiles(files))
+
+	// the metadata of the secret is copied into the template of the sealed secret
+	secret.Labels = stringMap(d.Get("secret_labels"))
+	secret.Annotations = stringMap(d.Get("secret_annotations"))
+	if err := kubeseal.SetScope(&secret, d.Get("scope").(string)); err != nil {
+		return v1.Secret{}, err
+	}
+	return secret, nil
+}
+
+// addData adds the values to the data of the secret, a key can only be set once across data, binary_data and data_from_files.
+func addData(secret *v1.Secret, values map[string][]byte) error {
+	for k, v := range values {
+		if _, ok := secret.Data[k]; ok {
+			return fmt.Errorf("the key %s is set more than once in data, binary_data and data_from_files", k)
+		}
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data[k] = v
+	}
+	return nil
+}
+
+func decodeBinaryData(values map[string]string) (map[string][]byte, error) {
+	data := make(map[string][]byte, len(values))
+	for k, v := range values {
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("the value of binary_data key %s is not base64 encoded: %w", k, err)
+		}
+		data[k] = b
+	}
+	return data, nil
+}
+
+// readDataFromFiles returns the contents of the files by key.
+func readDataFromFiles(paths map[string]string) (map[string][]byte, error) {
+	files := make(map[string][]byte, len(paths))
+	for k, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read data_from_files key %s: %w", k, err)
+		}
+		files[k] = b
+	}
+	return files, nil
+}
+
+// hashDataFromFiles returns the hex encoded SHA-256 hash of the keys and contents, or an empty string without files.
+func hashDataFromFiles(files map[string][]byte) string {
+	if len(files) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(files))
+	for k := range files {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s\x00%d\x00", k, len(files[k]))
+		h.Write(files[k])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// hashedValuePrefix marks the values stored by store_hashes_only.
+const hashedValuePrefix = "sha256:"
+
+func hashValue(v string) string {
+	return fmt.Sprintf("%s%x", hashedValuePrefix, sha256.Sum256([]byte(v)))
+}
+
+func hashValues(m map[string]interface{}) map[string]interface{} {
+	hashed := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		hashed[k] = hashValue(v.(string))
+	}
+	return hashed
+}
+
+// suppressHashedValuesDiff suppresses the diff of the maps stored with store_hashes_only if every configured value
+// matches its stored hash. If anything else requires a re-seal, nothing is suppressed, so the plan contains all
+// plaintext values needed to re-seal the secret.
+func suppressHashedValuesDiff(k, old, new string, d *schema.ResourceData) bool {
+	if !d.Get("store_hashes_only").(bool) {
+		return false
+	}
+	for _, attr := range sealedAttributes {
+		if attr != "data" && attr != "binary_data" && attr != "data_from_files_hash" && d.HasChange(attr) {
+			return false
+		}
+	}
+	if requiresResealOnTypeChange(d) {
+		return false
+	}
+	for _, attr := range []string{"data", "binary_data"} {
+		o, n := d.GetChange(attr)
+		if !hashedValuesMatch(o.(map[string]interface{}), n.(map[string]interface{})) {
+			return false
+		}
+	}
+	return true
+}
+
+// forceNewWithHashedValues replaces the resource if a re-seal is planned during CustomizeDiff while data or binary_data
+// are stored as hashes. Their diff was already suppressed, only the plan of a new resource contains the plaintext.
+func forceNewWithHashedValues(d *schema.ResourceDiff, key string) error {
+	if d.Id() == "" || !d.Get("store_hashes_only").(bool) {
+		return nil
+	}
+	if len(d.Get("data").(map[string]interface{})) == 0 && len(d.Get("binary_data").(map[string]interface{})) == 0 {
+		return nil
+	}
+	return d.ForceNew(key)
+}
+
+func hashedValuesMatch(hashed, values map[string]interface{}) bool {
+	if len(hashed) != len(values) {
+		return false
+	}
+	for k, v := range values {
+		if hashed[k] != hashValue(v.(string)) {
+			return false
+		}
+	}
+	return true
+}
+
+// stringMap converts a TypeMap of strings, an empty map results in nil.
+func stringMap(v interface{}) map[string]string {
+	m, _ := v.(map[string]interface{})
+	if len(m) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		result[k] = v.(string)
+	}
+	return result
 }
 
 func fetchPublicKey(ctx context.Context, pkResolver kubeseal.PKResolverFunc) (*rsa.PublicKey, error) {
@@ -147,10 +729,109 @@ func fetchPublicKey(ctx context.Context, pkResolver kubeseal.PKResolverFunc) (*r
 	return pk, nil
 }
 
+// certExpiryDiagnostics warns if the sealing certificate expires within threshold.
+// The certificate is already cached by the resolver, so this does not add a request.
+func certExpiryDiagnostics(ctx context.Context, certResolver kubeseal.CertResolverFunc, threshold time.Duration) diag.Diagnostics {
+	if threshold <= 0 {
+		return nil
+	}
+	c, err := certResolver(ctx)
+	if err != nil {
+		return nil
+	}
+	if remaining := time.Until(c.NotAfter); remaining < threshold {
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  "Sealing certificate expires soon",
+			Detail: fmt.Sprintf("The certificate with fingerprint %s expires at %s. Renew the sealing key of the controller "+
+				"and re-seal the secrets before it expires.", kubeseal.CertFingerprint(c), c.NotAfter.Format(time.RFC3339)),
+		}}
+	}
+	return nil
+}
+
+// certDiagnostics explains the likely causes of a failure to get the sealing certificate.
+func certDiagnostics(provider *ProviderConfig, err error) diag.Diagnostics {
+	controller := provider.controller()
+	attributes := "controller_name and controller_namespace"
+	permissions := "the get permission on the services/proxy resource for " + controller
+	if provider.ControllerSelector != "" {
+		attributes = "controller_selector and controller_namespace"
+		permissions = fmt.Sprintf("the list permission on services in %s to discover the controller with controller_selector, "+
+			"and the get permission on the services/proxy resource", provider.ControllerNamespace)
+	}
+	var summary, detail string
+	switch {
+	case errors.Is(err, kubeseal.ErrCertFingerprintMismatch):
+		summary = "Sealing certificate does not match pinned_cert_fingerprint"
+		detail = "No secret was sealed. Verify that the provider points to the intended controller. " +
+			"If the controller's key was rotated on purpose, update pinned_cert_fingerprint with the new fingerprint."
+	case errors.Is(err, kubeseal.ErrNotPEM):
+		summary = "The controller did not return a certificate"
+		detail = fmt.Sprintf("The request was most likely proxied to another service or port than the one of the sealed-secret-controller. "+
+			"Verify %s (%s), and that controller_port and controller_scheme match the service.", attributes, controller)
+	case errors.Is(err, kubeseal.ErrNotRSA):
+		summary = "The sealing certificate does not contain an RSA key"
+		detail = "The sealed-secret-controller only uses RSA keys. Verify that controller_cert_pem or the fetched certificate belongs to the controller."
+	case errors.Is(err, kubeseal.ErrKeyTooSmall):
+		summary = "The sealing key is too small"
+		detail = "Rotate the sealing key of the controller to a larger key, or lower min_key_size."
+	case k8sErrors.IsNotFound(err):
+		summary = "The sealed-secret-controller service was not found"
+		detail = fmt.Sprintf("Verify that the controller is installed and that %s (%s) match its service.", attributes, controller)
+	case k8sErrors.IsForbidden(err) || k8sErrors.IsUnauthorized(err):
+		summary = "Not allowed to fetch the certificate from the sealed-secret-controller"
+		detail = fmt.Sprintf("The credentials of the kubernetes block need %s.", permissions)
+	case k8sErrors.IsServiceUnavailable(err):
+		summary = "The sealed-secret-controller is unavailable"
+		detail = fmt.Sprintf("The service of %s has no ready endpoints for the requested port. Verify that the controller is running "+
+			"and that controller_port and controller_scheme match the service.", controller)
+	default:
+		return diag.FromErr(err)
+	}
+	return diag.Diagnostics{{
+		Severity: diag.Error,
+		Summary:  summary,
+		Detail:   err.Error() + "\n\n" + detail,
+	}}
+}
+
+// diagnosticsError returns the first error of diags as an error, for functions such as CustomizeDiff
+// which can not return diagnostics.
+func diagnosticsError(diags diag.Diagnostics) error {
+	for _, d := range diags {
+		if d.Severity != diag.Error {
+			continue
+		}
+		if d.Detail == "" {
+			return errors.New(d.Summary)
+		}
+		return fmt.Errorf("%s: %s", d.Summary, d.Detail)
+	}
+	return nil
+}
+
+// hashPublicKey returns the hex encoded SHA-256 hash of the DER encoded SubjectPublicKeyInfo.
 func hashPublicKey(pk *rsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(pk)
+	if err != nil {
+		// not reachable for RSA keys
+		panic(err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(der))
+}
+
+// legacyHashPublicKey is the hash stored by schema version 0. A matching legacy hash is not a key change,
+// since the state upgrader keeps it when the key can not be fetched.
+func legacyHashPublicKey(pk *rsa.PublicKey) string {
 	return fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprintf("%v%v", pk.N, pk.E))))
 }
 
 func logDebug(s string) {
 	log.Printf("[DEBUG] %s", s)
 }
+
+// logTiming logs the duration of an operation in a key=value format to ease filtering.
+func logTiming(operation, name string, start time.Time) {
+	log.Printf("[INFO] timing operation=%s secret=%s duration_ms=%d", operation, name, time.Since(start).Milliseconds())
+}
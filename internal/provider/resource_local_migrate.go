@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"context"
+	"github.com/akselleirv/sealedsecret/internal/kubeseal"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// resourceLocalV0 is the schema of version 0, where public_key_hash was a SHA-1 hash.
+func resourceLocalV0() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"name":                      {Type: schema.TypeString, Required: true},
+			"namespace":                 {Type: schema.TypeString, Required: true},
+			"type":                      {Type: schema.TypeString, Optional: true},
+			"data":                      {Type: schema.TypeMap, Optional: true, Sensitive: true},
+			"controller_cert_pem":       {Type: schema.TypeString, Optional: true},
+			"annotate_cert_fingerprint": {Type: schema.TypeBool, Optional: true},
+			"reseal_in_place":           {Type: schema.TypeBool, Optional: true},
+			"yaml_content":              {Type: schema.TypeString, Computed: true},
+			"public_key_hash":           {Type: schema.TypeString, Computed: true},
+		},
+	}
+}
+
+// resourceLocalV0Defaults are the defaults of attributes missing in the state of the first release. Without them
+// the plan shows a change to the default, which replaces every resource for the ForceNew annotate_cert_fingerprint.
+var resourceLocalV0Defaults = map[string]interface{}{
+	"scope":                     "strict",
+	"annotate_cert_fingerprint": false,
+	"reseal_in_place":           false,
+	"store_hashes_only":         false,
+}
+
+// resourceLocalStateUpgradeV0 fills in resourceLocalV0Defaults and replaces the SHA-1 public_key_hash with the SHA-256
+// one if it matches the current key. If the key can not be fetched, e.g. with offline refresh, the legacy hash is kept
+// and accepted by the next refresh.
+func resourceLocalStateUpgradeV0(ctx context.Context, rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+	for k, v := range resourceLocalV0Defaults {
+		if rawState[k] == nil {
+			rawState[k] = v
+		}
+	}
+
+	provider, ok := meta.(*ProviderConfig)
+	if !ok || provider.OfflineRefresh {
+		return rawState, nil
+	}
+	certPEM, _ := rawState["controller_cert_pem"].(string)
+	certResolver, err := provider.certResolver(certPEM)
+	if err != nil {
+		return rawState, nil
+	}
+	pk, err := kubeseal.PKResolver(certResolver)(ctx)
+	if err != nil {
+		logDebug("Keeping the legacy public key hash, unable to fetch the public key: " + err.Error())
+		return rawState, nil
+	}
+	if rawState["public_key_hash"] == legacyHashPublicKey(pk) {
+		rawState["public_key_hash"] = hashPublicKey(pk)
+	}
+	return rawState, nil
+}
@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	ctyjson "github.com/hashicorp/go-cty/cty/json"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+func TestResourceLocalStateUpgradeV0(t *testing.T) {
+	pk := &rsa.PublicKey{N: big.NewInt(3233), E: 17}
+	provider := &ProviderConfig{CertResolver: func(context.Context) (*x509.Certificate, error) {
+		return &x509.Certificate{PublicKey: pk}, nil
+	}}
+
+	state, err := resourceLocalStateUpgradeV0(context.Background(), map[string]interface{}{"public_key_hash": legacyHashPublicKey(pk)}, provider)
+	assert.NoError(t, err)
+	assert.Equal(t, hashPublicKey(pk), state["public_key_hash"])
+
+	state, err = resourceLocalStateUpgradeV0(context.Background(), map[string]interface{}{"public_key_hash": "rotated"}, provider)
+	assert.NoError(t, err)
+	assert.Equal(t, "rotated", state["public_key_hash"])
+
+	provider.CertResolver = func(context.Context) (*x509.Certificate, error) {
+		return nil, errors.New("unreachable")
+	}
+	state, err = resourceLocalStateUpgradeV0(context.Background(), map[string]interface{}{"public_key_hash": legacyHashPublicKey(pk)}, provider)
+	assert.NoError(t, err)
+	assert.Equal(t, legacyHashPublicKey(pk), state["public_key_hash"])
+}
+
+func TestResourceLocalStateUpgradeV0Defaults(t *testing.T) {
+	pk := &rsa.PublicKey{N: big.NewInt(3233), E: 17}
+	provider := testProviderWithKey(pk)
+	// the state of the first release, before any of the optional attributes existed
+	rawState := map[string]interface{}{
+		"id":              "secret",
+		"name":            "secret",
+		"namespace":       "default",
+		"type":            "Opaque",
+		"data":            map[string]interface{}{"key": "value_aa"},
+		"yaml_content":    "apiVersion: bitnami.com/v1alpha1\nkind: SealedSecret\nspec:\n  encryptedData:\n    key: encrypted_aa\n",
+		"public_key_hash": hashPublicKey(pk),
+	}
+	upgraded, err := resourceLocalStateUpgradeV0(context.Background(), rawState, provider)
+	assert.NoError(t, err)
+
+	b, err := json.Marshal(upgraded)
+	assert.NoError(t, err)
+	val, err := ctyjson.Unmarshal(b, resourceLocal().CoreConfigSchema().ImpliedType())
+	assert.NoError(t, err)
+	state, err := resourceLocal().ShimInstanceStateFromValue(val)
+	assert.NoError(t, err)
+	state, diags := resourceLocal().RefreshWithoutUpgrade(context.Background(), state, provider)
+	assert.False(t, diags.HasError())
+
+	diff, err := resourceLocal().Diff(context.Background(), state, terraform.NewResourceConfigRaw(map[string]interface{}{
+		"name":      "secret",
+		"namespace": "default",
+		"data":      map[string]interface{}{"key": "value_aa"},
+	}), provider)
+	assert.NoError(t, err)
+	assert.Nil(t, diff, "upgrading must neither replace nor update existing resources")
+}
@@ -1,12 +1,25 @@
 package provider
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"github.com/akselleirv/sealedsecret/internal/kubeseal"
+	"github.com/bitnami-labs/sealed-secrets/pkg/crypto"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	"github.com/stretchr/testify/assert"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	k8sschema "k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/yaml"
+	"math/big"
 
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -76,3 +89,330 @@ func testAccCheckYamlContentProduced(t *testing.T, resourceName string) resource
 		return nil
 	}
 }
+
+func TestReadDataFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "ca.crt"), []byte("cert_aa"), 0600))
+
+	files, err := readDataFromFiles(map[string]string{"ca.crt": filepath.Join(dir, "ca.crt")})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]byte{"ca.crt": []byte("cert_aa")}, files)
+
+	h := hashDataFromFiles(files)
+	assert.Len(t, h, 64)
+	assert.NotEqual(t, h, hashDataFromFiles(map[string][]byte{"ca.crt": []byte("cert_bb")}))
+	assert.Equal(t, "", hashDataFromFiles(nil))
+
+	_, err = readDataFromFiles(map[string]string{"missing": filepath.Join(dir, "missing")})
+	assert.Error(t, err)
+}
+
+func TestDecodeBinaryData(t *testing.T) {
+	data, err := decodeBinaryData(map[string]string{"keystore": "AAEC/w=="})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x00, 0x01, 0x02, 0xff}, data["keystore"])
+
+	_, err = decodeBinaryData(map[string]string{"keystore": "not base64"})
+	assert.Error(t, err)
+}
+
+func TestHashedValuesMatch(t *testing.T) {
+	hashed := hashValues(map[string]interface{}{"key_aa": "value_aa", "key_bb": "value_bb"})
+
+	assert.True(t, hashedValuesMatch(hashed, map[string]interface{}{"key_aa": "value_aa", "key_bb": "value_bb"}))
+	assert.False(t, hashedValuesMatch(hashed, map[string]interface{}{"key_aa": "value_aa", "key_bb": "value_cc"}))
+	assert.False(t, hashedValuesMatch(hashed, map[string]interface{}{"key_aa": "value_aa"}))
+	assert.False(t, hashedValuesMatch(map[string]interface{}{"key_aa": "value_aa"}, map[string]interface{}{"key_aa": "value_aa"}))
+}
+
+// testResourceLocalState returns the state of an existing sealedsecret_local, overridden by attributes.
+// The attributes added after the first release have the defaults filled in by the state upgrade.
+func testResourceLocalState(attributes map[string]string) *terraform.InstanceState {
+	state := map[string]string{
+		"id":                 "secret",
+		"name":               "secret",
+		"namespace":          "default",
+		"type":               "Opaque",
+		"yaml_content":       "sealed_aa",
+		"encrypted_data.%":   "1",
+		"encrypted_data.key": "encrypted_aa",
+		"public_key_hash":    "hash_aa",
+	}
+	for k, v := range resourceLocalV0Defaults {
+		state[k] = fmt.Sprint(v)
+	}
+	for k, v := range attributes {
+		state[k] = v
+	}
+	return &terraform.InstanceState{ID: "secret", Attributes: state}
+}
+
+func TestResourceLocalDiffDataFromFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ca.crt")
+	assert.NoError(t, os.WriteFile(path, []byte("cert_aa"), 0600))
+	state := testResourceLocalState(map[string]string{
+		"data_from_files.%":    "1",
+		"data_from_files.key":  path,
+		"data_from_files_hash": hashDataFromFiles(map[string][]byte{"key": []byte("cert_aa")}),
+	})
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"name":            "secret",
+		"namespace":       "default",
+		"data_from_files": map[string]interface{}{"key": path},
+	})
+
+	diff, err := resourceLocal().Diff(context.Background(), state, config, &ProviderConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, diff, "unchanged files must not plan a change")
+
+	assert.NoError(t, os.WriteFile(path, []byte("cert_bb"), 0600))
+	diff, err = resourceLocal().Diff(context.Background(), state, config, &ProviderConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, hashDataFromFiles(map[string][]byte{"key": []byte("cert_bb")}), diff.Attributes["data_from_files_hash"].New)
+	assert.True(t, diff.Attributes["yaml_content"].NewComputed)
+	assert.True(t, diff.Attributes["encrypted_data.%"].NewComputed)
+	assert.False(t, diff.RequiresNew())
+
+	assert.NoError(t, os.Remove(path))
+	diff, err = resourceLocal().Diff(context.Background(), state, config, &ProviderConfig{})
+	assert.NoError(t, err)
+	assert.True(t, diff.Attributes["data_from_files_hash"].NewComputed)
+	assert.True(t, diff.Attributes["yaml_content"].NewComputed)
+	assert.True(t, diff.Attributes["encrypted_data.%"].NewComputed)
+}
+
+func TestResourceLocalUpdateStoreHashesOnly(t *testing.T) {
+	plaintext := testResourceLocalState(map[string]string{
+		"data.%":   "1",
+		"data.key": "value_aa",
+	})
+	config := map[string]interface{}{
+		"name":              "secret",
+		"namespace":         "default",
+		"data":              map[string]interface{}{"key": "value_aa"},
+		"store_hashes_only": true,
+	}
+
+	diff, err := resourceLocal().Diff(context.Background(), plaintext, terraform.NewResourceConfigRaw(config), &ProviderConfig{})
+	assert.NoError(t, err)
+	hashed, diags := resourceLocal().Apply(context.Background(), plaintext, diff, &ProviderConfig{})
+	assert.Nil(t, diags)
+	assert.Equal(t, hashValue("value_aa"), hashed.Attributes["data.key"])
+	assert.Equal(t, "sealed_aa", hashed.Attributes["yaml_content"], "the secret must not be re-sealed")
+
+	diff, err = resourceLocal().Diff(context.Background(), hashed, terraform.NewResourceConfigRaw(config), &ProviderConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, diff, "the hashes must match the configured values")
+
+	config["store_hashes_only"] = false
+	diff, err = resourceLocal().Diff(context.Background(), hashed, terraform.NewResourceConfigRaw(config), &ProviderConfig{})
+	assert.NoError(t, err)
+	state, diags := resourceLocal().Apply(context.Background(), hashed, diff, &ProviderConfig{})
+	assert.Nil(t, diags)
+	assert.Equal(t, "value_aa", state.Attributes["data.key"])
+	assert.Equal(t, "sealed_aa", state.Attributes["yaml_content"], "the secret must not be re-sealed")
+}
+
+// testProviderWithKey returns a provider resolving a certificate with pk.
+func testProviderWithKey(pk *rsa.PublicKey) *ProviderConfig {
+	return &ProviderConfig{CertResolver: func(context.Context) (*x509.Certificate, error) {
+		return &x509.Certificate{PublicKey: pk}, nil
+	}}
+}
+
+func TestResourceLocalDiffResealInPlace(t *testing.T) {
+	pk := &rsa.PublicKey{N: big.NewInt(3233), E: 17}
+	state := testResourceLocalState(map[string]string{"reseal_in_place": "true", "public_key_hash": "rotated"})
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"name":            "secret",
+		"namespace":       "default",
+		"reseal_in_place": true,
+	})
+
+	diff, err := resourceLocal().Diff(context.Background(), state, config, testProviderWithKey(pk))
+	assert.NoError(t, err)
+	assert.Equal(t, hashPublicKey(pk), diff.Attributes["public_key_hash"].New)
+	assert.True(t, diff.Attributes["yaml_content"].NewComputed)
+	assert.True(t, diff.Attributes["encrypted_data.%"].NewComputed)
+	assert.False(t, diff.RequiresNew())
+}
+
+func TestResourceLocalKeyRotation(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	pk := &key.PublicKey
+	provider := testProviderWithKey(pk)
+	config := map[string]interface{}{
+		"name":      "secret",
+		"namespace": "default",
+		"data":      map[string]interface{}{"key": "value_aa"},
+	}
+	rotated := map[string]string{"data.%": "1", "data.key": "value_aa", "public_key_hash": "rotated"}
+
+	t.Run("reseal in place plans an update", func(t *testing.T) {
+		rotated["reseal_in_place"] = "true"
+		config["reseal_in_place"] = true
+		defer delete(rotated, "reseal_in_place")
+		defer delete(config, "reseal_in_place")
+
+		state, diags := resourceLocal().RefreshWithoutUpgrade(context.Background(), testResourceLocalState(rotated), provider)
+		assert.Nil(t, diags)
+		assert.Equal(t, "secret", state.ID)
+		assert.Equal(t, "rotated", state.Attributes["public_key_hash"], "the old hash is kept to plan the re-seal")
+
+		diff, err := resourceLocal().Diff(context.Background(), state, terraform.NewResourceConfigRaw(config), provider)
+		assert.NoError(t, err)
+		assert.False(t, diff.RequiresNew())
+		assert.Equal(t, hashPublicKey(pk), diff.Attributes["public_key_hash"].New)
+
+		state, diags = resourceLocal().Apply(context.Background(), state, diff, provider)
+		assert.False(t, diags.HasError(), "%v", diags)
+		assert.Equal(t, "secret", state.ID)
+		assert.Equal(t, hashPublicKey(pk), state.Attributes["public_key_hash"])
+		assert.NotEqual(t, "sealed_aa", state.Attributes["yaml_content"])
+		assert.NotEqual(t, "encrypted_aa", state.Attributes["encrypted_data.key"])
+	})
+
+	t.Run("without reseal in place the resource is recreated", func(t *testing.T) {
+		state, diags := resourceLocal().RefreshWithoutUpgrade(context.Background(), testResourceLocalState(rotated), provider)
+		assert.Nil(t, diags)
+		assert.Nil(t, state, "the cleared ID removes the resource from the state")
+	})
+
+	t.Run("a legacy hash is not a rotation", func(t *testing.T) {
+		legacy := map[string]string{"data.%": "1", "data.key": "value_aa", "public_key_hash": legacyHashPublicKey(pk), "reseal_in_place": "true"}
+		config["reseal_in_place"] = true
+		defer delete(config, "reseal_in_place")
+
+		diff, err := resourceLocal().Diff(context.Background(), testResourceLocalState(legacy), terraform.NewResourceConfigRaw(config), provider)
+		assert.NoError(t, err)
+		assert.Nil(t, diff)
+
+		legacy["reseal_in_place"] = "false"
+		state, diags := resourceLocal().RefreshWithoutUpgrade(context.Background(), testResourceLocalState(legacy), provider)
+		assert.Nil(t, diags)
+		assert.Equal(t, "secret", state.ID)
+		assert.Equal(t, hashPublicKey(pk), state.Attributes["public_key_hash"])
+		assert.Equal(t, "sealed_aa", state.Attributes["yaml_content"])
+	})
+}
+
+func TestCertDiagnosticsForbidden(t *testing.T) {
+	err := fmt.Errorf("unable to list services: %w", k8sErrors.NewForbidden(k8sschema.GroupResource{Resource: "services"}, "", errors.New("denied")))
+	provider := &ProviderConfig{ControllerName: "sealed-secrets", ControllerNamespace: "kube-system"}
+
+	diags := certDiagnostics(provider, err)
+	assert.Contains(t, diags[0].Detail, "get permission on the services/proxy resource for kube-system/sealed-secrets")
+
+	provider.ControllerSelector = "app.kubernetes.io/name=sealed-secrets"
+	diags = certDiagnostics(provider, err)
+	assert.Contains(t, diags[0].Detail, "list permission on services in kube-system")
+	assert.NotContains(t, diags[0].Detail, "sealed-secrets/")
+	assert.NotContains(t, certDiagnostics(provider, fmt.Errorf("%w", kubeseal.ErrNotPEM))[0].Detail, "controller_name and")
+}
+
+func TestResourceLocalDiffResealInPlaceCertError(t *testing.T) {
+	provider := &ProviderConfig{
+		ControllerName:      "sealed-secrets",
+		ControllerNamespace: "kube-system",
+		CertResolver: func(context.Context) (*x509.Certificate, error) {
+			return nil, k8sErrors.NewForbidden(k8sschema.GroupResource{Resource: "services/proxy"}, "sealed-secrets", errors.New("denied"))
+		},
+	}
+	state := testResourceLocalState(map[string]string{"reseal_in_place": "true"})
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"name":            "secret",
+		"namespace":       "default",
+		"reseal_in_place": true,
+	})
+
+	_, err := resourceLocal().Diff(context.Background(), state, config, provider)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Not allowed to fetch the certificate from the sealed-secret-controller")
+	assert.Contains(t, err.Error(), "get permission on the services/proxy resource for kube-system/sealed-secrets")
+}
+
+// testDecrypt decrypts a value of encrypted_data sealed with the strict scope.
+func testDecrypt(t *testing.T, key *rsa.PrivateKey, encrypted, namespace, name string) string {
+	fp, err := crypto.PublicKeyFingerprint(&key.PublicKey)
+	assert.NoError(t, err)
+	ciphertext, err := base64.StdEncoding.DecodeString(encrypted)
+	assert.NoError(t, err)
+	plaintext, err := crypto.HybridDecrypt(rand.Reader, map[string]*rsa.PrivateKey{fp: key}, ciphertext, []byte(namespace+"/"+name))
+	assert.NoError(t, err)
+	return string(plaintext)
+}
+
+func TestResourceLocalResealWithStoredHashes(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	provider := testProviderWithKey(&key.PublicKey)
+	hashed := map[string]string{
+		"store_hashes_only": "true",
+		"data.%":            "1",
+		"data.key":          hashValue("value_aa"),
+		"binary_data.%":     "1",
+		"binary_data.bin":   hashValue("AAEC/w=="),
+		"public_key_hash":   hashPublicKey(&key.PublicKey),
+	}
+	config := map[string]interface{}{
+		"name":              "secret",
+		"namespace":         "default",
+		"data":              map[string]interface{}{"key": "value_aa"},
+		"binary_data":       map[string]interface{}{"bin": "AAEC/w=="},
+		"store_hashes_only": true,
+	}
+
+	t.Run("a changed namespace re-seals the plaintext", func(t *testing.T) {
+		config["namespace"] = "other"
+		defer func() { config["namespace"] = "default" }()
+
+		diff, err := resourceLocal().Diff(context.Background(), testResourceLocalState(hashed), terraform.NewResourceConfigRaw(config), provider)
+		assert.NoError(t, err)
+		assert.False(t, diff.RequiresNew())
+		state, diags := resourceLocal().Apply(context.Background(), testResourceLocalState(hashed), diff, provider)
+		assert.False(t, diags.HasError(), "%v", diags)
+
+		assert.Equal(t, "value_aa", testDecrypt(t, key, state.Attributes["encrypted_data.key"], "other", "secret"))
+		assert.Equal(t, "\x00\x01\x02\xff", testDecrypt(t, key, state.Attributes["encrypted_data.bin"], "other", "secret"))
+		assert.Equal(t, hashValue("value_aa"), state.Attributes["data.key"])
+		assert.Equal(t, hashValue("AAEC/w=="), state.Attributes["binary_data.bin"])
+	})
+
+	t.Run("a key rotation replaces the resource", func(t *testing.T) {
+		rotated := map[string]string{"reseal_in_place": "true", "public_key_hash": "rotated"}
+		for k, v := range hashed {
+			if _, ok := rotated[k]; !ok {
+				rotated[k] = v
+			}
+		}
+		config["reseal_in_place"] = true
+		defer delete(config, "reseal_in_place")
+
+		diff, err := resourceLocal().Diff(context.Background(), testResourceLocalState(rotated), terraform.NewResourceConfigRaw(config), provider)
+		assert.NoError(t, err)
+		assert.True(t, diff.RequiresNew(), "the plaintext is only planned for a new resource")
+		state, diags := resourceLocal().Apply(context.Background(), testResourceLocalState(rotated), diff, provider)
+		assert.False(t, diags.HasError(), "%v", diags)
+
+		assert.Equal(t, "value_aa", testDecrypt(t, key, state.Attributes["encrypted_data.key"], "default", "secret"))
+		assert.Equal(t, hashValue("value_aa"), state.Attributes["data.key"])
+	})
+
+	t.Run("changed files replace the resource", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ca.crt")
+		assert.NoError(t, os.WriteFile(path, []byte("cert_bb"), 0600))
+		files := map[string]string{"data_from_files.%": "1", "data_from_files.ca": path, "data_from_files_hash": "outdated"}
+		for k, v := range hashed {
+			files[k] = v
+		}
+		config["data_from_files"] = map[string]interface{}{"ca": path}
+		defer delete(config, "data_from_files")
+
+		diff, err := resourceLocal().Diff(context.Background(), testResourceLocalState(files), terraform.NewResourceConfigRaw(config), provider)
+		assert.NoError(t, err)
+		assert.True(t, diff.RequiresNew())
+		assert.Equal(t, "value_aa", diff.Attributes["data.key"].New)
+	})
+}
@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"fmt"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// validateSecretName requires an RFC 1123 subdomain, like the API server does for Secrets.
+var validateSecretName = validateK8sName(validation.IsDNS1123Subdomain)
+
+// validateNamespaceName requires an RFC 1123 label, like the API server does for Namespaces.
+var validateNamespaceName = validateK8sName(validation.IsDNS1123Label)
+
+// validateK8sName returns a ValidateDiagFunc using one of the validation.IsDNS1123* funcs of apimachinery.
+func validateK8sName(validate func(string) []string) schema.SchemaValidateDiagFunc {
+	return func(v interface{}, path cty.Path) diag.Diagnostics {
+		if errs := validate(v.(string)); len(errs) > 0 {
+			return diag.Diagnostics{{
+				Severity:      diag.Error,
+				Summary:       fmt.Sprintf("Invalid Kubernetes name %q", v.(string)),
+				Detail:        strings.Join(errs, "\n"),
+				AttributePath: path,
+			}}
+		}
+		return nil
+	}
+}
+
+// validateSecretKeys reports every key of the map which is not a valid key of a Secret.
+func validateSecretKeys(v interface{}, path cty.Path) diag.Diagnostics {
+	m := v.(map[string]interface{})
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var diags diag.Diagnostics
+	for _, k := range keys {
+		if errs := validation.IsConfigMapKey(k); len(errs) > 0 {
+			diags = append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       fmt.Sprintf("Invalid secret key %q", k),
+				Detail:        strings.Join(errs, "\n"),
+				AttributePath: path.IndexString(k),
+			})
+		}
+	}
+	return diags
+}
+
+// validateFileMode requires an octal permission string like 0644.
+func validateFileMode(v interface{}, path cty.Path) diag.Diagnostics {
+	mode, err := strconv.ParseUint(v.(string), 8, 32)
+	if err != nil || mode > 0777 {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       fmt.Sprintf("invalid permission %q", v.(string)),
+			Detail:        "The permission must be an octal string between 0000 and 0777, e.g. 0644.",
+			AttributePath: path,
+		}}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package provider
+
+import (
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestValidateK8sNames(t *testing.T) {
+	tests := []struct {
+		Name      string
+		Validate  schema.SchemaValidateDiagFunc
+		Value     string
+		ExpectErr bool
+	}{
+		{Name: "secret name", Validate: validateSecretName, Value: "my-secret", ExpectErr: false},
+		{Name: "secret name with dots", Validate: validateSecretName, Value: "tls.example.com", ExpectErr: false},
+		{Name: "secret name with upper case", Validate: validateSecretName, Value: "My-Secret", ExpectErr: true},
+		{Name: "secret name with underscore", Validate: validateSecretName, Value: "my_secret", ExpectErr: true},
+		{Name: "secret name too long", Validate: validateSecretName, Value: strings.Repeat("a", 254), ExpectErr: true},
+		{Name: "namespace", Validate: validateNamespaceName, Value: "kube-system", ExpectErr: false},
+		{Name: "namespace with dots", Validate: validateNamespaceName, Value: "team.apps", ExpectErr: true},
+		{Name: "namespace too long", Validate: validateNamespaceName, Value: strings.Repeat("a", 64), ExpectErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			path := cty.GetAttrPath("name")
+			diags := tc.Validate(tc.Value, path)
+			assert.Equal(t, tc.ExpectErr, diags.HasError())
+			if tc.ExpectErr {
+				assert.Equal(t, path, diags[0].AttributePath)
+			}
+		})
+	}
+}
+
+func TestValidateSecretKeys(t *testing.T) {
+	tests := []struct {
+		Name        string
+		Keys        []string
+		ExpectPaths []cty.Path
+	}{
+		{Name: "valid keys", Keys: []string{"password", ".dockerconfigjson", "tls.crt", "API_KEY-1"}},
+		{Name: "empty key", Keys: []string{""}, ExpectPaths: []cty.Path{cty.GetAttrPath("data").IndexString("")}},
+		{
+			Name: "invalid keys are reported sorted",
+			Keys: []string{"valid", "with space", "a/b", ".."},
+			ExpectPaths: []cty.Path{
+				cty.GetAttrPath("data").IndexString(".."),
+				cty.GetAttrPath("data").IndexString("a/b"),
+				cty.GetAttrPath("data").IndexString("with space"),
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			m := map[string]interface{}{}
+			for _, k := range tc.Keys {
+				m[k] = "value"
+			}
+			// spare capacity must not be shared between the paths of the diagnostics
+			path := make(cty.Path, 0, 4)
+			path = append(path, cty.GetAttrStep{Name: "data"})
+
+			diags := validateSecretKeys(m, path)
+			var paths []cty.Path
+			for _, d := range diags {
+				paths = append(paths, d.AttributePath)
+			}
+			assert.Equal(t, tc.ExpectPaths, paths)
+		})
+	}
+}